@@ -0,0 +1,272 @@
+package main
+
+import (
+	"FinalProject/internal/classroom-app/model"
+	"FinalProject/internal/classroom-app/validator"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// defaultCheckInTTL is how long a check-in code is valid if the teacher doesn't say.
+	defaultCheckInTTL = 10 * time.Minute
+
+	// maxCheckInTTL is the longest a check-in code can be valid, the length of a long class.
+	maxCheckInTTL = 4 * time.Hour
+)
+
+// attendanceColumns are the columns of the attendance CSV export.
+var attendanceColumns = []string{"date", "session_id", "email", "first_name", "last_name", "status", "checked_in", "recorded_at"}
+
+// getAttendanceHandler returns the attendance of every student of the classroom at one
+// occurrence of a session, with a null status for the students nothing is recorded for.
+func (app *application) getAttendanceHandler(w http.ResponseWriter, r *http.Request) {
+	session, date, ok := app.readOccurrence(w, r)
+	if !ok {
+		return
+	}
+
+	attendance, err := app.models.Attendance.GetForOccurrence(session, date)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"attendance": attendance}, nil)
+}
+
+// recordAttendanceHandler records the attendance of students at one occurrence of a session.
+// Students that aren't in the records are left as they are.
+func (app *application) recordAttendanceHandler(w http.ResponseWriter, r *http.Request) {
+	session, date, ok := app.readOccurrence(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Records []model.AttendanceRecord `json:"records"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	if model.ValidateAttendanceRecords(v, input.Records); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Attendance.Record(session, date, input.Records, app.contextGetActor(r))
+	if err != nil {
+		app.attendanceErrorResponse(w, r, err)
+		return
+	}
+
+	attendance, err := app.models.Attendance.GetForOccurrence(session, date)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"attendance": attendance}, nil)
+}
+
+// createCheckInCodeHandler creates a code for the teacher to show in class, which students check
+// in to the session occurrence with until it expires after ttl, a duration like "10m".
+func (app *application) createCheckInCodeHandler(w http.ResponseWriter, r *http.Request) {
+	session, date, ok := app.readOccurrence(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		TTL string `json:"ttl"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ttl := defaultCheckInTTL
+	v := validator.New()
+	if input.TTL != "" {
+		ttl, err = time.ParseDuration(input.TTL)
+		v.Check(err == nil, "ttl", "must be a duration like 10m")
+		v.Check(err != nil || (ttl >= time.Minute && ttl <= maxCheckInTTL), "ttl", fmt.Sprintf("must be between 1m and %s", maxCheckInTTL))
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	code, err := app.models.Attendance.NewCheckInCode(session, date, ttl, app.contextGetActor(r))
+	if err != nil {
+		app.attendanceErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusCreated, envelope{"checkInCode": code}, nil)
+}
+
+// checkInHandler checks the user in to the session occurrence of a check-in code as present.
+func (app *application) checkInHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Code string `json:"code"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(len(input.Code) == 26, "code", "must be 26 bytes long")
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	attendance, err := app.models.Attendance.CheckIn(input.Code, app.contextGetUser(r).Id, app.contextGetActor(r))
+	if err != nil {
+		app.attendanceErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"attendance": attendance}, nil)
+}
+
+// attendanceSummaryHandler returns the attendance counts and rate of every student of the
+// classroom.
+func (app *application) attendanceSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil || id < 1 {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if _, err := app.models.Classrooms.Get(id); err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if !app.requireTeacher(w, r, id) {
+		return
+	}
+
+	summaries, err := app.models.Attendance.Summary(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"attendance": summaries}, nil)
+}
+
+// exportAttendanceHandler writes every recorded attendance of the classroom as CSV, escaping
+// cells that spreadsheets would take for formulas.
+func (app *application) exportAttendanceHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil || id < 1 {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if _, err := app.models.Classrooms.Get(id); err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if !app.requireTeacher(w, r, id) {
+		return
+	}
+
+	attendance, err := app.models.Attendance.GetAllOfClass(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="class-%d-attendance.csv"`, id))
+
+	writer := csv.NewWriter(w)
+	writer.Write(attendanceColumns)
+	for _, entry := range attendance {
+		writer.Write([]string{
+			entry.Date,
+			strconv.Itoa(entry.SessionId),
+			csvCell(entry.Email),
+			csvCell(entry.FirstName),
+			csvCell(entry.LastName),
+			*entry.Status,
+			strconv.FormatBool(entry.CheckedIn),
+			entry.RecordedAt.UTC().Format(time.RFC3339),
+		})
+	}
+	writer.Flush()
+
+	if err := writer.Error(); err != nil {
+		app.logError(r, err)
+	}
+}
+
+// readOccurrence reads the session of the id parameter and the date parameter, which must be a
+// date the session takes place on, for a teacher of the session's classroom. It sends an error
+// response and returns false otherwise.
+func (app *application) readOccurrence(w http.ResponseWriter, r *http.Request) (*model.ClassSession, string, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil || id < 1 {
+		app.badRequestResponse(w, r, err)
+		return nil, "", false
+	}
+
+	session, err := app.models.Sessions.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, "", false
+	}
+
+	date := mux.Vars(r)["date"]
+	if !session.TakesPlaceOn(date) {
+		app.notFoundResponse(w, r)
+		return nil, "", false
+	}
+
+	if !app.requireTeacher(w, r, session.ClassId) {
+		return nil, "", false
+	}
+	return session, date, true
+}
+
+func (app *application) attendanceErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	var fieldErrors model.FieldErrors
+	switch {
+	case errors.Is(err, model.ErrRecordNotFound):
+		app.notFoundResponse(w, r)
+	case errors.Is(err, model.ErrArchived):
+		app.archivedResponse(w, r)
+	case errors.Is(err, model.ErrNotStudent):
+		app.notPermittedResponse(w, r)
+	case errors.As(err, &fieldErrors):
+		app.failedValidationResponse(w, r, fieldErrors)
+	default:
+		app.serverErrorResponse(w, r, err)
+	}
+}
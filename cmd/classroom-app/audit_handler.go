@@ -0,0 +1,53 @@
+package main
+
+import (
+	"FinalProject/internal/classroom-app/model"
+	"FinalProject/internal/classroom-app/validator"
+	"net/http"
+)
+
+func (app *application) listAuditHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		model.AuditFilters
+		model.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.AuditFilters.ActorID = app.readInt(qs, "actor", 0, v)
+	input.AuditFilters.EntityType = app.readStrings(qs, "entity", "")
+	input.AuditFilters.EntityID = app.readInt(qs, "entity_id", 0, v)
+	input.AuditFilters.From = app.readTime(qs, "from", v)
+	input.AuditFilters.To = app.readTime(qs, "to", v)
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readStrings(qs, "sort", "-id")
+
+	input.Filters.SortSafeList = []string{"-id"}
+
+	if input.AuditFilters.EntityType != "" {
+		v.Check(validator.In(input.AuditFilters.EntityType,
+			model.EntityClassroom, model.EntityTask, model.EntityUser, model.EntityPermission, model.EntityToken,
+			model.EntityMember, model.EntityTemplate, model.EntityTerm, model.EntityRoom, model.EntitySession,
+			model.EntityAttendance, model.EntityQuiz,
+		), "entity", "invalid entity type")
+	}
+	v.Check(input.AuditFilters.EntityID == 0 || input.AuditFilters.EntityType != "", "entity_id", "requires entity")
+	if !input.AuditFilters.From.IsZero() && !input.AuditFilters.To.IsZero() {
+		v.Check(input.AuditFilters.From.Before(input.AuditFilters.To), "to", "must be after from")
+	}
+
+	if model.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	entries, metadata, err := app.models.Audit.GetAll(input.AuditFilters, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"audit": entries, "metadata": metadata}, nil)
+}
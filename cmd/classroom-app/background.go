@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// background runs fn in a goroutine tracked by app.wg, so that serve() waits for it to finish
+// during a graceful shutdown. A panic in fn is logged instead of crashing the server.
+func (app *application) background(fn func()) {
+	app.wg.Add(1)
+
+	go func() {
+		defer app.wg.Done()
+
+		defer func() {
+			if err := recover(); err != nil {
+				log.Println(fmt.Errorf("background task panic: %v", err))
+			}
+		}()
+
+		fn()
+	}()
+}
+
+// every calls fn every interval in the background until the application starts shutting down.
+func (app *application) every(interval time.Duration, fn func()) {
+	app.background(func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-app.quit:
+				return
+			case <-ticker.C:
+				fn()
+			}
+		}
+	})
+}
+
+// startBackgroundJobs starts the job workers and schedules the periodic maintenance jobs of
+// the application.
+func (app *application) startBackgroundJobs() {
+	app.registerJobs()
+	app.startWorkers(app.config.jobs.workers)
+
+	app.schedule(time.Hour, jobPurgeTrash)
+	app.schedule(30*time.Second, jobDeliverWebhooks)
+	app.schedule(24*time.Hour, jobCleanupJobs)
+	app.schedule(time.Hour, jobCleanupStale)
+	app.schedule(time.Minute, jobSendReminders)
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"FinalProject/internal/classroom-app/model"
+	"FinalProject/internal/classroom-app/validator"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// maxBatchSize is the largest number of operations a batch can have.
+const maxBatchSize = 100
+
+// Modes of a batch.
+const (
+	batchTransactional = "transactional"
+	batchBestEffort    = "best_effort"
+)
+
+// errBatchForbidden is the result of an operation the user isn't permitted to run.
+var errBatchForbidden = errors.New("batch operation forbidden")
+
+// batchHandler runs several creates, updates and deletes of classrooms and tasks in one
+// request. In transactional mode, the default, either all operations are applied or none is,
+// and the response status is the one of the operation that failed. In best_effort mode every
+// operation is applied on its own and the response has the result of each. Every operation
+// needs the same permission as its own endpoint.
+func (app *application) batchHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Mode       string                  `json:"mode"`
+		Operations []*model.BatchOperation `json:"operations"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Mode == "" {
+		input.Mode = batchTransactional
+	}
+
+	v := validator.New()
+	v.Check(validator.In(input.Mode, batchTransactional, batchBestEffort), "mode", "must be transactional or best_effort")
+	v.Check(len(input.Operations) > 0, "operations", "must be provided")
+	v.Check(len(input.Operations) <= maxBatchSize, "operations", fmt.Sprintf("must not have more than %d operations", maxBatchSize))
+
+	for i, op := range input.Operations {
+		if op == nil {
+			v.AddError(fmt.Sprintf("operations[%d]", i), "must be an object")
+			continue
+		}
+
+		ov := validator.New()
+		model.ValidateBatchOperation(ov, op)
+		for key, message := range ov.Errors {
+			v.AddError(fmt.Sprintf("operations[%d].%s", i, key), message)
+		}
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	permissions, err := app.models.Permissions.GetAllForUser(user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	transactional := input.Mode == batchTransactional
+
+	// Operations the user isn't permitted to run are never sent to the database. In a
+	// transactional batch a single one of them aborts the whole batch.
+	results := make([]model.BatchResult, len(input.Operations))
+	var permitted []*model.BatchOperation
+	var indexes []int
+	for i, op := range input.Operations {
+		code := batchPermission(op)
+		if code != "" && !permissions.Include(code) {
+			results[i].Err = errBatchForbidden
+			continue
+		}
+		permitted = append(permitted, op)
+		indexes = append(indexes, i)
+	}
+
+	status := http.StatusOK
+
+	if transactional && len(permitted) < len(input.Operations) {
+		for i := range results {
+			if results[i].Err == nil {
+				results[i].Err = model.ErrBatchAborted
+			}
+		}
+		status = http.StatusForbidden
+	} else if len(permitted) > 0 {
+		ran, err := app.models.Batch.Run(permitted, transactional, app.contextGetActor(r))
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		for j, result := range ran {
+			results[indexes[j]] = result
+		}
+	}
+
+	response := make([]envelope, len(results))
+	for i, result := range results {
+		op := input.Operations[i]
+		response[i] = app.batchResultResponse(r, i, op, result)
+
+		if result.Err == nil {
+			app.batchSideEffects(r, op, result.Record)
+		} else if transactional && !errors.Is(result.Err, model.ErrBatchAborted) {
+			status = response[i]["status"].(int)
+		}
+	}
+
+	app.writeJSON(w, status, envelope{"mode": input.Mode, "results": response}, nil)
+}
+
+// batchPermission returns the permission an operation needs, the same one as the endpoint that
+// does the same thing. Classrooms can be created and updated by every activated user.
+func batchPermission(op *model.BatchOperation) string {
+	switch {
+	case op.Type == model.BatchTask:
+		return "task:write"
+	case op.Type == model.BatchClassroom && op.Op == model.BatchDelete:
+		return "class:write"
+	default:
+		return ""
+	}
+}
+
+// batchResultResponse describes the result of an operation with the status code and error
+// message its own endpoint would have responded with.
+func (app *application) batchResultResponse(r *http.Request, index int, op *model.BatchOperation, result model.BatchResult) envelope {
+	var fieldErrors model.FieldErrors
+
+	switch {
+	case result.Err == nil:
+		status := http.StatusOK
+		if op.Op == model.BatchCreate {
+			status = http.StatusCreated
+		}
+		response := envelope{"index": index, "status": status}
+		if result.Record != nil {
+			response[op.Type] = result.Record
+		}
+		return response
+	case errors.As(result.Err, &fieldErrors):
+		return envelope{"index": index, "status": http.StatusUnprocessableEntity, "error": fieldErrors}
+	case errors.Is(result.Err, errBatchForbidden):
+		message := "your user account doesn't have the necessary permissions to access this resource"
+		return envelope{"index": index, "status": http.StatusForbidden, "error": message}
+	case errors.Is(result.Err, model.ErrRecordNotFound):
+		message := "the requested resource could not be found"
+		return envelope{"index": index, "status": http.StatusNotFound, "error": message}
+	case errors.Is(result.Err, model.ErrEditConflict):
+		message := "unable to update the record due to an edit conflict, please try again"
+		return envelope{"index": index, "status": http.StatusConflict, "error": message}
+	case errors.Is(result.Err, model.ErrArchived):
+		message := "the classroom is archived and read-only, unarchive it first"
+		return envelope{"index": index, "status": http.StatusConflict, "error": message}
+	case errors.Is(result.Err, model.ErrBatchAborted):
+		message := "not applied because another operation of the batch failed"
+		return envelope{"index": index, "status": http.StatusFailedDependency, "error": message}
+	default:
+		app.logError(r, result.Err)
+		message := "the server encountered a problem and could not process this operation"
+		return envelope{"index": index, "status": http.StatusInternalServerError, "error": message}
+	}
+}
+
+// batchSideEffects sends the webhooks, live updates and notifications of an applied operation,
+// the same ones its own endpoint sends.
+func (app *application) batchSideEffects(r *http.Request, op *model.BatchOperation, record any) {
+	switch record := record.(type) {
+	case *model.Classroom:
+		if op.Op == model.BatchCreate {
+			app.emitEvent(model.EventClassroomCreated, record)
+		}
+	case *model.Task:
+		switch op.Op {
+		case model.BatchCreate:
+			app.emitEvent(model.EventTaskCreated, envelope{"task": record, "classrooms": op.Classrooms})
+			app.publishClassEvent(streamTaskCreated, record, op.Classrooms...)
+			app.notify(r, model.EventTaskCreated, model.EntityTask, record.Id, "New task: "+record.Header, "task:read")
+		case model.BatchUpdate:
+			app.emitEvent(model.EventTaskUpdated, record)
+			app.publishTaskEvent(streamTaskUpdated, record, record.Id)
+			app.notify(r, model.EventTaskUpdated, model.EntityTask, record.Id, "Task updated: "+record.Header, "task:read")
+		}
+	case nil:
+		switch {
+		case op.Op == model.BatchDelete && op.Type == model.BatchClassroom:
+			app.publishClassEvent(streamClassroomDeleted, envelope{"id": op.Id}, op.Id)
+		case op.Op == model.BatchDelete && op.Type == model.BatchTask:
+			app.publishTaskEvent(streamTaskDeleted, envelope{"id": op.Id}, op.Id)
+		}
+	}
+}
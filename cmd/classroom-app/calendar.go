@@ -0,0 +1,201 @@
+package main
+
+import (
+	"FinalProject/internal/classroom-app/model"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// icsTimeFormat is the UTC date-time format of iCalendar (RFC 5545, section 3.3.5).
+const icsTimeFormat = "20060102T150405Z"
+
+// writeCalendar writes the tasks as an iCalendar (RFC 5545) with one VEVENT per due date. The
+// UID of an event stays the same for the life of the task, and its SEQUENCE is the version of
+// the task, so calendar clients replace an event when the task changes.
+func writeCalendar(w io.Writer, name string, tasks []model.Task) error {
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//classroom-app//calendar " + version + "//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:" + icsEscape(name),
+	}
+
+	for _, task := range tasks {
+		updated := parseTimestamp(task.UpdatedAt).UTC()
+
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			fmt.Sprintf("UID:task-%d@classroom-app", task.Id),
+			fmt.Sprintf("SEQUENCE:%d", task.Version),
+			"DTSTAMP:"+updated.Format(icsTimeFormat),
+			"LAST-MODIFIED:"+updated.Format(icsTimeFormat),
+			"DTSTART:"+task.DueAt.UTC().Format(icsTimeFormat),
+			"SUMMARY:"+icsEscape(task.Header),
+		)
+		if task.Description != "" {
+			lines = append(lines, "DESCRIPTION:"+icsEscape(task.Description))
+		}
+		lines = append(lines, "TRANSP:TRANSPARENT", "END:VEVENT")
+	}
+
+	lines = append(lines, "END:VCALENDAR")
+
+	for _, line := range lines {
+		if _, err := io.WriteString(w, icsFold(line)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// icsLocalTimeFormat is the floating date-time format of iCalendar, a wall clock time that is
+// the same in every time zone.
+const icsLocalTimeFormat = "20060102T150405"
+
+// writeTimetable writes the class sessions as an iCalendar (RFC 5545) with one weekly recurring
+// VEVENT per session. Session times are wall clock times, so they are written as floating
+// times that calendar clients show as they are. Dates a session is cancelled on are EXDATEs.
+func writeTimetable(w io.Writer, name string, sessions []*model.TimetableSession) error {
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//classroom-app//calendar " + version + "//EN",
+		"CALSCALE:GREGORIAN",
+		"METHOD:PUBLISH",
+		"X-WR-CALNAME:" + icsEscape(name),
+	}
+
+	for _, session := range sessions {
+		startsOn, err := time.Parse("2006-01-02", session.StartsOn)
+		if err != nil {
+			return err
+		}
+		endsOn, err := time.Parse("2006-01-02", session.EndsOn)
+		if err != nil {
+			return err
+		}
+
+		// The first occurrence is the first day of the date range on the session's weekday.
+		first := startsOn.AddDate(0, 0, (session.Weekday-int(startsOn.Weekday())+7)%7)
+		if first.After(endsOn) {
+			continue
+		}
+
+		start, err := atClock(first, session.StartsAt)
+		if err != nil {
+			return err
+		}
+		end, err := atClock(first, session.EndsAt)
+		if err != nil {
+			return err
+		}
+
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			fmt.Sprintf("UID:session-%d@classroom-app", session.Id),
+			fmt.Sprintf("SEQUENCE:%d", session.Version),
+			"DTSTAMP:"+session.CreatedAt.UTC().Format(icsTimeFormat),
+			"DTSTART:"+start.Format(icsLocalTimeFormat),
+			"DTEND:"+end.Format(icsLocalTimeFormat),
+			"RRULE:FREQ=WEEKLY;UNTIL="+endsOn.Format("20060102")+"T235959",
+			"SUMMARY:"+icsEscape(session.ClassName),
+		)
+		for _, exception := range session.Exceptions {
+			date, err := time.Parse("2006-01-02", exception)
+			if err != nil {
+				return err
+			}
+			excluded, err := atClock(date, session.StartsAt)
+			if err != nil {
+				return err
+			}
+			lines = append(lines, "EXDATE:"+excluded.Format(icsLocalTimeFormat))
+		}
+		if location := sessionLocation(session); location != "" {
+			lines = append(lines, "LOCATION:"+icsEscape(location))
+		}
+		lines = append(lines, "END:VEVENT")
+	}
+
+	lines = append(lines, "END:VCALENDAR")
+
+	for _, line := range lines {
+		if _, err := io.WriteString(w, icsFold(line)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// atClock returns the date at the time of day clock, like 15:04.
+func atClock(date time.Time, clock string) (time.Time, error) {
+	t, err := time.Parse("15:04", clock)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Date(date.Year(), date.Month(), date.Day(), t.Hour(), t.Minute(), 0, 0, time.UTC), nil
+}
+
+// sessionLocation is the name of the room of a session, or empty if it has none.
+func sessionLocation(session *model.TimetableSession) string {
+	if session.RoomName == nil {
+		return ""
+	}
+	return *session.RoomName
+}
+
+// icsEscaper escapes the characters that are special in iCalendar TEXT values.
+var icsEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	";", `\;`,
+	",", `\,`,
+	"\r\n", `\n`,
+	"\n", `\n`,
+	"\r", `\n`,
+)
+
+func icsEscape(s string) string {
+	return icsEscaper.Replace(s)
+}
+
+// icsFold terminates a content line with CRLF, folding it so that no line is longer than 75
+// octets. Folds never split a UTF-8 sequence.
+func icsFold(line string) string {
+	var b strings.Builder
+
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !isRuneStart(line[cut]) {
+			cut--
+		}
+
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+
+		// Continuation lines start with a space, which counts towards their length.
+		limit = 74
+	}
+
+	b.WriteString(line)
+	b.WriteString("\r\n")
+	return b.String()
+}
+
+func isRuneStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// calendarURL is the path of the calendar feed of a token.
+func calendarURL(token string) string {
+	return "/api/v1/calendar/" + token + ".ics"
+}
+
+// calendarTokenTTL is how long a calendar feed token is valid. Calendar clients keep using the
+// same URL, so it is long, and users rotate the token if the URL leaks.
+const calendarTokenTTL = 5 * 365 * 24 * time.Hour
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"FinalProject/internal/classroom-app/model"
+	"FinalProject/internal/classroom-app/validator"
+	"bytes"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// calendarHistory is how long past due dates stay in the calendar feed.
+const calendarHistory = 180 * 24 * time.Hour
+
+// calendarFeedHandler serves the due dates of the tasks of the classrooms the user is a member
+// of, or of one of them, as an iCalendar feed. Calendar clients can't send a bearer token, so
+// the feed is authenticated by the calendar token in its URL instead.
+func (app *application) calendarFeedHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.calendarUser(w, r)
+	if !ok {
+		return
+	}
+
+	// The token only stands in for the bearer header; the user still needs to be allowed to
+	// read tasks when the feed is fetched.
+	permissions, err := app.models.Permissions.GetAllForUser(user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if !permissions.Include("task:read") {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	name := "Classroom deadlines"
+	classId := 0
+	if id, ok := mux.Vars(r)["id"]; ok {
+		classId, err = strconv.Atoi(id)
+		if err != nil || classId < 1 {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		classroom, err := app.models.Classrooms.Get(classId)
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		// Classrooms the user isn't in look the same as ones that don't exist.
+		if _, err := app.models.Members.GetRole(classId, user.Id); err != nil {
+			switch {
+			case errors.Is(err, model.ErrRecordNotFound):
+				app.notFoundResponse(w, r)
+			default:
+				app.serverErrorResponse(w, r, err)
+			}
+			return
+		}
+		name = classroom.Name + " deadlines"
+	}
+
+	tasks, err := app.models.Tasks.GetDue(user.Id, classId, calendarHistory)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	tag := []any{name}
+	for _, task := range tasks {
+		tag = append(tag, task.Id, task.Version)
+	}
+	if app.notModified(w, r, weakETag(tag...), time.Time{}) {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := writeCalendar(&buf, name, tasks); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="deadlines.ics"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// timetableFeedHandler serves the class sessions of the classrooms the user is a member of as
+// an iCalendar feed of weekly recurring events. Like the deadline feed it is authenticated by
+// the calendar token in its URL.
+func (app *application) timetableFeedHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.calendarUser(w, r)
+	if !ok {
+		return
+	}
+
+	sessions, err := app.models.Sessions.GetForUser(user.Id, time.Now().Add(-calendarHistory))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	tag := []any{"timetable"}
+	for _, session := range sessions {
+		tag = append(tag, session.Id, session.Version, session.ClassName, sessionLocation(session))
+	}
+	if app.notModified(w, r, weakETag(tag...), time.Time{}) {
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := writeTimetable(&buf, "Timetable", sessions); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="timetable.ics"`)
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+}
+
+// calendarUser returns the activated user of the calendar token in the URL. It sends an error
+// response and returns false if there is none.
+func (app *application) calendarUser(w http.ResponseWriter, r *http.Request) (*model.User, bool) {
+	token := mux.Vars(r)["token"]
+
+	v := validator.New()
+	if model.ValidateTokenPlaintext(v, token); !v.Valid() {
+		app.notFoundResponse(w, r)
+		return nil, false
+	}
+
+	user, err := app.models.Users.GetForToken(model.ScopeCalendar, token)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+
+	if !user.Activated {
+		app.notPermittedResponse(w, r)
+		return nil, false
+	}
+	return user, true
+}
+
+// rotateCalendarTokenHandler replaces the calendar feed token of the user with a new one. The
+// old feed URL stops working.
+func (app *application) rotateCalendarTokenHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+	actor := app.contextGetActor(r)
+
+	err := app.models.Tokens.DeleteAllForUser(model.ScopeCalendar, user.Id, actor)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	token, err := app.models.Tokens.New(user.Id, calendarTokenTTL, model.ScopeCalendar, actor)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusCreated, envelope{"calendar_token": token, "url": calendarURL(token.Plaintext)}, nil)
+}
+
+// revokeCalendarTokenHandler deletes the calendar feed token of the user.
+func (app *application) revokeCalendarTokenHandler(w http.ResponseWriter, r *http.Request) {
+	err := app.models.Tokens.DeleteAllForUser(model.ScopeCalendar, app.contextGetUser(r).Id, app.contextGetActor(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"result": "Success"}, nil)
+}
@@ -5,14 +5,17 @@ import (
 	"FinalProject/internal/classroom-app/validator"
 	"database/sql"
 	"errors"
+	jsonpatch "github.com/evanphx/json-patch/v5"
 	"log"
 	"net/http"
+	"time"
 )
 
 func (app *application) createClassHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
 		Name        string `json:"name"`
 		Description string `json:"description"`
+		TermId      *int   `json:"termId"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -24,6 +27,7 @@ func (app *application) createClassHandler(w http.ResponseWriter, r *http.Reques
 	classroom := &model.Classroom{
 		Name:        input.Name,
 		Description: input.Description,
+		TermId:      input.TermId,
 	}
 
 	v := validator.New()
@@ -32,13 +36,26 @@ func (app *application) createClassHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.models.Classrooms.Insert(classroom)
+	err = app.models.Classrooms.Insert(classroom, app.contextGetActor(r))
 
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		var fieldErrors model.FieldErrors
+		switch {
+		case errors.As(err, &fieldErrors):
+			app.failedValidationResponse(w, r, fieldErrors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
-	app.writeJSON(w, http.StatusCreated, envelope{"classroom": classroom}, nil)
+
+	// Nobody but the creator is a member of a new classroom yet, so there is no one to notify.
+	app.emitEvent(model.EventClassroomCreated, classroom)
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(classroom.Version))
+
+	app.writeJSON(w, http.StatusCreated, envelope{"classroom": classroom}, headers)
 }
 
 func (app *application) getClassHandler(w http.ResponseWriter, r *http.Request) {
@@ -57,37 +74,65 @@ func (app *application) getClassHandler(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	if app.notModified(w, r, etag(classroom.Version), parseTimestamp(classroom.UpdatedAt)) {
+		return
+	}
+
 	app.writeJSON(w, http.StatusOK, envelope{"classroom": classroom}, nil)
 }
 
 func (app *application) getClassesList(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Name string
+		Name     string
+		Term     int
+		Archived string
 		model.Filters
 	}
 	v := validator.New()
 	qs := r.URL.Query()
 
 	input.Name = app.readStrings(qs, "name", "")
+	input.Term = app.readInt(qs, "term", 0, v)
+	input.Archived = app.readStrings(qs, "archived", model.ArchivedHide)
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
 	input.Filters.Sort = app.readStrings(qs, "sort", "id")
+	input.Filters.Cursor = app.readStrings(qs, "cursor", "")
+	input.Filters.Filter = app.readStrings(qs, "filter", "")
 
 	input.Filters.SortSafeList = []string{
 		"id", "name",
 		"-id", "-name",
 	}
 
+	input.Filters.FilterSafeList = map[string]model.FilterField{
+		"id":          {Column: "id", Type: model.FilterInt},
+		"name":        {Column: "name", Type: model.FilterText},
+		"description": {Column: "description", Type: model.FilterText},
+		"created_at":  {Column: "created_at", Type: model.FilterTime},
+	}
+
+	v.Check(input.Term >= 0, "term", "must be a valid term id")
+	v.Check(validator.In(input.Archived, model.ArchivedHide, model.ArchivedOnly, model.ArchivedAll), "archived", "must be true, false or all")
+
 	if model.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
 	}
-	classrooms, metadata, err := app.models.Classrooms.GetAll(input.Name, input.Filters)
+	classrooms, metadata, err := app.models.Classrooms.GetAll(input.Name, input.Term, input.Archived, input.Filters)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
+	tag := []any{metadata.TotalRecords, metadata.NextCursor}
+	for _, classroom := range classrooms {
+		tag = append(tag, classroom.Id, classroom.Version)
+	}
+	if app.notModified(w, r, weakETag(tag...), time.Time{}) {
+		return
+	}
+
 	app.writeJSON(w, http.StatusOK, envelope{"classrooms": classrooms, "metadata": metadata}, nil)
 }
 
@@ -107,9 +152,15 @@ func (app *application) updateClassHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
+	if !app.ifMatch(r, etag(classroom.Version)) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
 	var input struct {
 		Name        *string `json:"name"`
 		Description *string `json:"description"`
+		TermId      *int    `json:"termId"`
 	}
 
 	err = app.readJSON(w, r, &input)
@@ -124,6 +175,13 @@ func (app *application) updateClassHandler(w http.ResponseWriter, r *http.Reques
 	if input.Description != nil {
 		classroom.Description = *input.Description
 	}
+	// A termId of 0 takes the classroom out of its term.
+	if input.TermId != nil {
+		classroom.TermId = input.TermId
+		if *input.TermId == 0 {
+			classroom.TermId = nil
+		}
+	}
 
 	v := validator.New()
 	if model.ValidateClassroom(v, classroom); !v.Valid() {
@@ -131,13 +189,26 @@ func (app *application) updateClassHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.models.Classrooms.Update(classroom)
+	err = app.models.Classrooms.Update(classroom, app.contextGetActor(r))
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		var fieldErrors model.FieldErrors
+		switch {
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, model.ErrArchived):
+			app.archivedResponse(w, r)
+		case errors.As(err, &fieldErrors):
+			app.failedValidationResponse(w, r, fieldErrors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
-	app.writeJSON(w, http.StatusOK, envelope{"classroom": classroom}, nil)
+	headers := make(http.Header)
+	headers.Set("ETag", etag(classroom.Version))
+
+	app.writeJSON(w, http.StatusOK, envelope{"classroom": classroom}, headers)
 }
 
 func (app *application) deleteClassHandler(w http.ResponseWriter, r *http.Request) {
@@ -147,11 +218,142 @@ func (app *application) deleteClassHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	err = app.models.Classrooms.Delete(id)
+	// Only look the classroom up when the client asked for a conditional delete.
+	version := 0
+	if r.Header.Get("If-Match") != "" {
+		classroom, err := app.models.Classrooms.Get(id)
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		if !app.ifMatch(r, etag(classroom.Version)) {
+			app.preconditionFailedResponse(w, r)
+			return
+		}
+		version = classroom.Version
+	}
+
+	err = app.models.Classrooms.Delete(id, version, app.contextGetActor(r))
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		var fieldErrors model.FieldErrors
+		switch {
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, model.ErrArchived):
+			app.archivedResponse(w, r)
+		case errors.As(err, &fieldErrors):
+			app.failedValidationResponse(w, r, fieldErrors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
+	app.publishClassEvent(streamClassroomDeleted, envelope{"id": id}, id)
+
 	app.writeJSON(w, http.StatusOK, envelope{"result": "Success"}, nil)
 }
+
+func (app *application) patchClassHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil || id < 1 {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	classroom, err := app.models.Classrooms.Get(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Class with ID %d not found", id)
+		}
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if !app.ifMatch(r, etag(classroom.Version)) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	var patched model.Classroom
+	err = app.readPatch(w, r, classroom, &patched)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnsupportedPatchType):
+			app.unsupportedPatchTypeResponse(w, r)
+		case errors.Is(err, jsonpatch.ErrTestFailed):
+			app.editConflictResponse(w, r)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+
+	v := validator.New()
+	v.Check(patched.Id == classroom.Id, "id", "cannot be modified")
+	v.Check(patched.CreatedAt == classroom.CreatedAt, "createdAt", "cannot be modified")
+	v.Check(patched.UpdatedAt == classroom.UpdatedAt, "updatedAt", "cannot be modified")
+	v.Check(patched.Version == classroom.Version, "version", "cannot be modified")
+	v.Check((patched.ArchivedAt == nil) == (classroom.ArchivedAt == nil), "archivedAt", "cannot be modified, use archive or unarchive")
+
+	if model.ValidateClassroom(v, &patched); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Classrooms.Update(&patched, app.contextGetActor(r))
+	if err != nil {
+		var fieldErrors model.FieldErrors
+		switch {
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, model.ErrArchived):
+			app.archivedResponse(w, r)
+		case errors.As(err, &fieldErrors):
+			app.failedValidationResponse(w, r, fieldErrors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(patched.Version))
+
+	app.writeJSON(w, http.StatusOK, envelope{"classroom": patched}, headers)
+}
+
+// archiveClassHandler archives a classroom, which makes it and its tasks read-only and hides
+// it from the classroom list.
+func (app *application) archiveClassHandler(w http.ResponseWriter, r *http.Request) {
+	app.setClassArchived(w, r, true)
+}
+
+func (app *application) unarchiveClassHandler(w http.ResponseWriter, r *http.Request) {
+	app.setClassArchived(w, r, false)
+}
+
+func (app *application) setClassArchived(w http.ResponseWriter, r *http.Request, archived bool) {
+	id, err := app.readIDParam(r)
+	if err != nil || id < 1 {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	classroom, err := app.models.Classrooms.SetArchived(id, archived, app.contextGetActor(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(classroom.Version))
+
+	app.writeJSON(w, http.StatusOK, envelope{"classroom": classroom}, headers)
+}
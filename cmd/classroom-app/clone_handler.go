@@ -0,0 +1,230 @@
+package main
+
+import (
+	"FinalProject/internal/classroom-app/model"
+	"FinalProject/internal/classroom-app/validator"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// cloneSyncLimit is the largest number of tasks a clone copies while the request waits. Clones
+// that copy more run as a background job.
+const cloneSyncLimit = 50
+
+// cloneProgressStep is after how many copied tasks a clone job reports its progress.
+const cloneProgressStep = 25
+
+// clonePayload is the payload of a clone job.
+type clonePayload struct {
+	ClassId int                `json:"classId"`
+	Options model.CloneOptions `json:"options"`
+	Actor   model.Actor        `json:"actor"`
+}
+
+// cloneClassHandler creates a new classroom from an existing one, for example for the next
+// term, optionally with copies of its tasks and its teachers. Small clones answer with the new
+// classroom, larger ones are queued as a job and answer 202 Accepted with the job, whose
+// progress and result are read with GET /job/:id.
+func (app *application) cloneClassHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil || id < 1 {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var input struct {
+		Name        *string `json:"name"`
+		Description *string `json:"description"`
+		TermId      *int    `json:"termId"`
+		Tasks       bool    `json:"tasks"`
+		Teachers    bool    `json:"teachers"`
+		Offset      *string `json:"offset"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	opts := model.CloneOptions{
+		Name:        input.Name,
+		Description: input.Description,
+		TermId:      input.TermId,
+		Tasks:       input.Tasks,
+		Teachers:    input.Teachers,
+	}
+
+	v := validator.New()
+	v.Check(input.TermId == nil || *input.TermId > 0, "termId", "must be a valid term id")
+	if input.Offset != nil {
+		offset, err := time.ParseDuration(*input.Offset)
+		v.Check(err == nil, "offset", "must be a duration like 168h")
+		opts.Offset = &offset
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if _, err := app.models.Classrooms.Get(id); err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	count := 0
+	if opts.Tasks {
+		count, err = app.models.Clones.CountTasks(id)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	if count > cloneSyncLimit {
+		app.enqueueClone(w, r, id, opts, count)
+		return
+	}
+
+	result, err := app.models.Clones.Clone(id, opts, app.contextGetActor(r), nil)
+	if err != nil {
+		var fieldErrors model.FieldErrors
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.As(err, &fieldErrors):
+			app.failedValidationResponse(w, r, fieldErrors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+	app.cloneSideEffects(result, &user.Id)
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(result.Classroom.Version))
+	headers.Set("Location", fmt.Sprintf("/api/v1/class/%d", result.Classroom.Id))
+
+	app.writeJSON(w, http.StatusCreated, envelope{"clone": result}, headers)
+}
+
+// enqueueClone queues a clone job and answers with it.
+func (app *application) enqueueClone(w http.ResponseWriter, r *http.Request, id int, opts model.CloneOptions, count int) {
+	js, err := json.Marshal(clonePayload{ClassId: id, Options: opts, Actor: app.contextGetActor(r)})
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	job := &model.Job{
+		Kind:    jobCloneClassroom,
+		Payload: js,
+		UserID:  &user.Id,
+		Total:   count,
+		// The clone runs in one transaction, a failed attempt leaves nothing behind.
+		MaxAttempts: 3,
+	}
+
+	err = app.models.Jobs.Enqueue(job)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("Location", fmt.Sprintf("/api/v1/job/%d", job.Id))
+
+	app.writeJSON(w, http.StatusAccepted, envelope{"job": job}, headers)
+}
+
+// runCloneJob clones a classroom in the background, reporting how many of its tasks have been
+// copied. The clone is the result of the job.
+func (app *application) runCloneJob(job *model.Job, payload clonePayload) error {
+	progress := func(done, total int) {
+		if done%cloneProgressStep != 0 && done != total {
+			return
+		}
+		if err := app.models.Jobs.SetProgress(job.Id, done, total); err != nil {
+			log.Printf("job %d progress: %s", job.Id, err)
+		}
+	}
+
+	result, err := app.models.Clones.Clone(payload.ClassId, payload.Options, payload.Actor, progress)
+	if err != nil {
+		var fieldErrors model.FieldErrors
+		if errors.As(err, &fieldErrors) {
+			return fmt.Errorf("clone classroom %d: %v", payload.ClassId, map[string]string(fieldErrors))
+		}
+		return fmt.Errorf("clone classroom %d: %w", payload.ClassId, err)
+	}
+
+	// The clone is committed, so a failure to record it must not make the job run again.
+	if err := app.models.Jobs.SetResult(job.Id, result); err != nil {
+		log.Printf("job %d result: %s", job.Id, err)
+	}
+
+	var actorID *int
+	if payload.Actor.UserID != 0 {
+		actorID = &payload.Actor.UserID
+	}
+	app.cloneSideEffects(result, actorID)
+
+	return nil
+}
+
+// cloneSideEffects sends the webhooks and the notification of a clone. Every copied task gets
+// its task.created webhook, but only the classroom is notified about, so a large clone doesn't
+// flood the notifications of every user.
+func (app *application) cloneSideEffects(result *model.CloneResult, actorID *int) {
+	classroom := result.Classroom
+
+	app.emitEvent(model.EventClassroomCreated, classroom)
+	for _, task := range result.Tasks {
+		app.emitEvent(model.EventTaskCreated, envelope{"task": task, "classrooms": []int{classroom.Id}})
+	}
+	// The teachers copied into the clone are its only members besides the user who cloned it.
+	app.notifyAs(actorID, model.EventClassroomCreated, model.EntityClassroom, classroom.Id, "New classroom: "+classroom.Name, "class:read")
+}
+
+// getJobHandler returns a job with its progress and result. Users with job:admin can see every
+// job, other users only the jobs they started.
+func (app *application) getJobHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil || id < 1 {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	job, err := app.models.Jobs.Get(int64(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	user := app.contextGetUser(r)
+	if job.UserID == nil || *job.UserID != user.Id {
+		permissions, err := app.models.Permissions.GetAllForUser(user.Id)
+		if err != nil {
+			app.serverErrorResponse(w, r, err)
+			return
+		}
+		if !permissions.Include("job:admin") {
+			app.notFoundResponse(w, r)
+			return
+		}
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"job": job}, nil)
+}
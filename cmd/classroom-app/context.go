@@ -3,6 +3,7 @@ package main
 import (
 	"FinalProject/internal/classroom-app/model"
 	"context"
+	"net"
 	"net/http"
 )
 
@@ -30,3 +31,35 @@ func (app *application) contextGetUser(r *http.Request) *model.User {
 
 	return user
 }
+
+// requestIDContextKey is used as a key for getting and setting the request id in the request
+// context.
+const requestIDContextKey = contextKey("request_id")
+
+// contextSetRequestID returns a new copy of the request with the provided request id added to
+// the context.
+func (app *application) contextSetRequestID(r *http.Request, id string) *http.Request {
+	ctx := context.WithValue(r.Context(), requestIDContextKey, id)
+	return r.WithContext(ctx)
+}
+
+// contextGetRequestID retrieves the request id from the request context, or "" if the request
+// didn't go through the requestID middleware.
+func (app *application) contextGetRequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDContextKey).(string)
+	return id
+}
+
+// contextGetActor describes the user making the request for the audit log.
+func (app *application) contextGetActor(r *http.Request) model.Actor {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	return model.Actor{
+		UserID:    app.contextGetUser(r).Id,
+		IP:        ip,
+		RequestID: app.contextGetRequestID(r),
+	}
+}
@@ -70,6 +70,23 @@ func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Requ
 	app.errorResponse(w, r, http.StatusConflict, message)
 }
 
+// preconditionFailedResponse sends a JSON-formatted error message to the client with a 412
+// Precondition Failed status code when the If-Match header doesn't match the current version.
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the record has been modified since you last fetched it, please fetch it again"
+	app.errorResponse(w, r, http.StatusPreconditionFailed, message)
+}
+
+// unsupportedPatchTypeResponse sends a JSON-formatted error message to the client with a 415
+// Unsupported Media Type status code and an Accept-Patch header listing the patch formats that
+// are supported.
+func (app *application) unsupportedPatchTypeResponse(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Accept-Patch", mergePatchType+", "+jsonPatchType)
+
+	message := fmt.Sprintf("the request content type is not supported, use %s or %s", mergePatchType, jsonPatchType)
+	app.errorResponse(w, r, http.StatusUnsupportedMediaType, message)
+}
+
 // invalidCredentialsResponse sends a JSON-formatted error with a 401 Unauthorized status code
 // to the client.
 func (app *application) invalidCredentialsResponse(w http.ResponseWriter, r *http.Request) {
@@ -100,6 +117,48 @@ func (app *application) inactiveAccountResponse(w http.ResponseWriter, r *http.R
 	app.errorResponse(w, r, http.StatusForbidden, message)
 }
 
+// archivedResponse sends a JSON-formatted error message to the client with a 409 Conflict
+// status code when a write would change an archived classroom or one of its tasks.
+func (app *application) archivedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the classroom is archived and read-only, unarchive it first"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// roomBookedResponse sends a JSON-formatted error message to the client with a 409 Conflict
+// status code when a class session would book a room that is taken at that time.
+func (app *application) roomBookedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the room is already booked by another session at that time"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// quizClosedResponse sends a JSON-formatted error message to the client with a 409 Conflict
+// status code when a quiz is attempted after it closed.
+func (app *application) quizClosedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the quiz is closed"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// attemptLimitResponse sends a JSON-formatted error message to the client with a 409 Conflict
+// status code when a user has no attempts left at a quiz.
+func (app *application) attemptLimitResponse(w http.ResponseWriter, r *http.Request) {
+	message := "you have used up your attempts at this quiz"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// attemptOverResponse sends a JSON-formatted error message to the client with a 409 Conflict
+// status code when a quiz attempt is submitted twice or after its time limit.
+func (app *application) attemptOverResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the attempt was already submitted or its time is up"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
+// quizAttemptedResponse sends a JSON-formatted error message to the client with a 409 Conflict
+// status code when the questions of a quiz are changed after students attempted it.
+func (app *application) quizAttemptedResponse(w http.ResponseWriter, r *http.Request) {
+	message := "the quiz has attempts, its questions can no longer be changed"
+	app.errorResponse(w, r, http.StatusConflict, message)
+}
+
 func (app *application) notPermittedResponse(w http.ResponseWriter, r *http.Request) {
 	message := "your user account doesn't have the necessary permissions to access this resource"
 	app.errorResponse(w, r, http.StatusForbidden, message)
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"FinalProject/internal/classroom-app/model"
+	"log"
+	"strconv"
+)
+
+// Types of the events on the event stream of a classroom.
+const (
+	streamTaskCreated      = model.EventTaskCreated
+	streamTaskUpdated      = model.EventTaskUpdated
+	streamTaskDeleted      = "task.deleted"
+	streamTaskRestored     = "task.restored"
+	streamTaskAttached     = "task.attached"
+	streamTaskDetached     = "task.detached"
+	streamClassroomDeleted = "classroom.deleted"
+)
+
+// classTopic is the broker topic of the events of a classroom.
+func classTopic(classId int) string {
+	return "class:" + strconv.Itoa(classId)
+}
+
+// taskTopic is the broker topic of the presence and typing messages of a task.
+func taskTopic(taskId int) string {
+	return "task:" + strconv.Itoa(taskId)
+}
+
+// publishClassEvent publishes an event on the stream of every given classroom. Like
+// emitEvent, failures are logged but don't fail the request that caused the event.
+func (app *application) publishClassEvent(eventType string, data any, classIds ...int) {
+	for _, classId := range classIds {
+		err := app.broker.Publish(classTopic(classId), eventType, data)
+		if err != nil {
+			log.Printf("publish %s to class %d: %s", eventType, classId, err)
+		}
+	}
+}
+
+// publishTaskEvent publishes an event about a task on the streams of the classrooms it belongs
+// to.
+func (app *application) publishTaskEvent(eventType string, task any, taskId int) {
+	classIds, err := app.models.Tasks.GetClassroomIds(taskId)
+	if err != nil {
+		log.Printf("publish %s for task %d: %s", eventType, taskId, err)
+		return
+	}
+
+	app.publishClassEvent(eventType, task, classIds...)
+}
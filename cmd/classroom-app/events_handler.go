@@ -0,0 +1,149 @@
+package main
+
+import (
+	"FinalProject/internal/classroom-app/broker"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// streamHeartbeat is how often a comment is sent on an idle stream, to keep proxies from
+	// closing the connection and to notice clients that have gone away.
+	streamHeartbeat = 15 * time.Second
+
+	// streamLifetime is how long a stream stays open. Clients reconnect with Last-Event-ID
+	// afterwards, which authenticates them again, so revoked tokens and permissions take
+	// effect on open streams too.
+	streamLifetime = time.Hour
+
+	// streamWriteTimeout is how long a single write to a client may take.
+	streamWriteTimeout = 10 * time.Second
+)
+
+// classEventsHandler streams the task events of a classroom as Server-Sent Events.
+func (app *application) classEventsHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// The classroom has to exist when the stream is opened. Its deletion ends the stream.
+	_, err = app.models.Classrooms.Get(id)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	// Browsers send Last-Event-ID when an EventSource reconnects. The query parameter lets
+	// clients resume a stream they open themselves.
+	lastEventId := r.Header.Get("Last-Event-ID")
+	if lastEventId == "" {
+		lastEventId = r.URL.Query().Get("last_event_id")
+	}
+
+	var lastId uint64
+	if lastEventId != "" {
+		lastId, err = strconv.ParseUint(lastEventId, 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, errors.New("invalid Last-Event-ID"))
+			return
+		}
+	}
+
+	sub, err := app.broker.Subscribe(classTopic(id), lastId)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	// send writes to the client with a deadline of its own, instead of the server-wide write
+	// timeout that would otherwise end the stream after 30 seconds.
+	send := func(format string, args ...any) bool {
+		if err := rc.SetWriteDeadline(time.Now().Add(streamWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return false
+		}
+		if _, err := fmt.Fprintf(w, format, args...); err != nil {
+			return false
+		}
+		return rc.Flush() == nil
+	}
+
+	if !send("retry: 3000\n\n") {
+		return
+	}
+
+	// A reset tells the client that events were lost and it has to reload the tasks.
+	if sub.Gap && !send("event: reset\ndata: {}\n\n") {
+		return
+	}
+
+	for _, event := range sub.Missed {
+		if !sendEvent(send, event) {
+			return
+		}
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	lifetime := time.NewTimer(streamLifetime)
+	defer lifetime.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-lifetime.C:
+			return
+		case <-heartbeat.C:
+			if !send(": heartbeat\n\n") {
+				return
+			}
+		case event, ok := <-sub.Events:
+			// The subscription ends when the server shuts down or the client fell too far
+			// behind. Either way the client reconnects and resumes from the last event.
+			if !ok {
+				return
+			}
+			if !sendEvent(send, event) || event.Type == streamClassroomDeleted {
+				return
+			}
+		}
+	}
+}
+
+func sendEvent(send func(string, ...any) bool, event broker.Event) bool {
+	return send("id: %d\nevent: %s\ndata: %s\n\n", event.Id, event.Type, event.Data)
+}
+
+// websocketHandler upgrades the request to a WebSocket. Over it clients can subscribe to the
+// events of several classrooms at once, see who is viewing a task and send typing indicators.
+func (app *application) websocketHandler(w http.ResponseWriter, r *http.Request) {
+	user := app.contextGetUser(r)
+
+	if !app.ws.connect(user.Id) {
+		app.errorResponse(w, r, http.StatusTooManyRequests, "too many open connections")
+		return
+	}
+	defer app.ws.disconnect(user.Id)
+
+	// Upgrade replies with an error itself if the handshake is invalid.
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+
+	newWSClient(app, conn, user).run()
+}
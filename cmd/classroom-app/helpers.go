@@ -2,16 +2,21 @@ package main
 
 import (
 	"FinalProject/internal/classroom-app/validator"
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	jsonpatch "github.com/evanphx/json-patch/v5"
 	"github.com/gorilla/mux"
+	"hash/fnv"
 	"io"
 	"log"
+	"mime"
 	"net/http"
 	"net/url"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type envelope map[string]any
@@ -158,3 +163,191 @@ func (app *application) readInt(qs url.Values, key string, defaultValue int, v *
 	// Otherwise, return the converted integer value.
 	return i
 }
+
+// etag returns the strong entity tag for a record with the given version.
+func etag(version int) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// ifMatch reports whether the If-Match header of the request matches the current entity tag of
+// the resource. Requests without the header always match. Weak tags never match, as If-Match
+// requires a strong comparison.
+func (app *application) ifMatch(r *http.Request, currentETag string) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == currentETag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// weakETag returns a weak entity tag derived from the given values. It is used for lists,
+// whose representation changes whenever any of the listed records do.
+func weakETag(values ...any) string {
+	h := fnv.New64a()
+	for _, value := range values {
+		fmt.Fprint(h, value, ";")
+	}
+
+	return fmt.Sprintf(`W/"%x"`, h.Sum64())
+}
+
+// csvCell escapes a cell of a CSV export that spreadsheets would run as a formula, by
+// prefixing it with a quote that makes them show it as text.
+func csvCell(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// csvUnescape undoes csvCell for a cell of an imported CSV file.
+func csvUnescape(s string) string {
+	if len(s) > 1 && s[0] == '\'' && strings.ContainsRune("=+-@\t\r", rune(s[1])) {
+		return s[1:]
+	}
+	return s
+}
+
+// parseTimestamp parses a timestamp column that was scanned into a string. It returns the
+// zero time if the value can't be parsed.
+func parseTimestamp(s string) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// notModified sets the caching headers of a read response and reports whether the client's
+// cached copy is still fresh. In that case a 304 Not Modified response has already been sent
+// and the handler must not write a body. If-None-Match takes precedence over If-Modified-Since,
+// and lastModified may be the zero time if the resource doesn't have one.
+func (app *application) notModified(w http.ResponseWriter, r *http.Request, currentETag string, lastModified time.Time) bool {
+	// Responses depend on the caller (see the Vary: Authorization header set by authenticate),
+	// so only the client itself may cache them, and it has to revalidate before reusing them.
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("ETag", currentETag)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if header := r.Header.Get("If-None-Match"); header != "" {
+		for _, tag := range strings.Split(header, ",") {
+			tag = strings.TrimSpace(tag)
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == strings.TrimPrefix(currentETag, "W/") {
+				w.WriteHeader(http.StatusNotModified)
+				return true
+			}
+		}
+		return false
+	}
+
+	if header := r.Header.Get("If-Modified-Since"); header != "" && !lastModified.IsZero() {
+		since, err := http.ParseTime(header)
+		if err == nil && !lastModified.Truncate(time.Second).After(since) {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+
+	return false
+}
+
+// Media types accepted by PATCH endpoints.
+const (
+	mergePatchType = "application/merge-patch+json"
+	jsonPatchType  = "application/json-patch+json"
+)
+
+var errUnsupportedPatchType = errors.New("unsupported patch media type")
+
+// readPatch applies the patch document in the request body to the JSON representation of
+// original and decodes the result into dst, which must point to a new zero value so that
+// fields removed by the patch end up cleared. The Content-Type header picks the format: JSON
+// Merge Patch (RFC 7396) or JSON Patch (RFC 6902). A failed JSON Patch "test" operation is
+// reported as jsonpatch.ErrTestFailed, an unknown media type as errUnsupportedPatchType.
+func (app *application) readPatch(w http.ResponseWriter, r *http.Request, original any, dst any) error {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != mergePatchType && mediaType != jsonPatchType) {
+		return errUnsupportedPatchType
+	}
+
+	maxBytes := 1_048_576
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, int64(maxBytes)))
+	if err != nil {
+		return fmt.Errorf("body must not be larger than %d bytes", maxBytes)
+	}
+	if len(body) == 0 {
+		return errors.New("body must not be empty")
+	}
+
+	doc, err := json.Marshal(original)
+	if err != nil {
+		return err
+	}
+
+	switch mediaType {
+	case mergePatchType:
+		doc, err = jsonpatch.MergePatch(doc, body)
+		if err != nil {
+			return fmt.Errorf("invalid merge patch: %w", err)
+		}
+	case jsonPatchType:
+		patch, err := jsonpatch.DecodePatch(body)
+		if err != nil {
+			return fmt.Errorf("invalid JSON patch: %w", err)
+		}
+
+		doc, err = patch.Apply(doc)
+		if err != nil {
+			return fmt.Errorf("unable to apply JSON patch: %w", err)
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(doc))
+	dec.DisallowUnknownFields()
+
+	err = dec.Decode(dst)
+	if err != nil {
+		var unmarshalTypeError *json.UnmarshalTypeError
+
+		switch {
+		case errors.As(err, &unmarshalTypeError):
+			return fmt.Errorf("patch results in incorrect JSON type for field %q", unmarshalTypeError.Field)
+		case strings.HasPrefix(err.Error(), "json: unknown field "):
+			fieldName := strings.TrimPrefix(err.Error(), "json: unknown field ")
+			return fmt.Errorf("patch results in unknown key %s", fieldName)
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readTime reads a date (2006-01-02) or RFC 3339 timestamp from the URL query string. It
+// returns the zero time if the key is missing, and records an error in the provided Validator
+// instance if the value can't be parsed.
+func (app *application) readTime(qs url.Values, key string, v *validator.Validator) time.Time {
+	s := qs.Get(key)
+	if s == "" {
+		return time.Time{}
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+
+	v.AddError(key, "must be a date (2006-01-02) or RFC 3339 timestamp")
+	return time.Time{}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"FinalProject/internal/classroom-app/model"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Kinds of background jobs.
+const (
+	jobPurgeTrash      = "trash.purge"
+	jobDeliverWebhooks = "webhooks.deliver"
+	jobCleanupJobs     = "jobs.cleanup"
+	jobSendReminders   = "reminders.send"
+	jobCleanupStale    = "maintenance.cleanup"
+	jobCloneClassroom  = "classroom.clone"
+)
+
+const (
+	// jobPollInterval is how long an idle worker waits before it looks for due jobs again.
+	jobPollInterval = time.Second
+
+	// jobLease is how long a job may run before it is assumed that its worker died, and it is
+	// handed to another worker.
+	jobLease = 10 * time.Minute
+
+	// jobRetention is how long succeeded jobs are kept.
+	jobRetention = 7 * 24 * time.Hour
+)
+
+// jobHandler runs a claimed job. A returned error fails this attempt.
+type jobHandler func(job *model.Job) error
+
+// handleJob registers fn as the handler of a kind of job. The payload of a job is decoded into
+// a T before fn is called with it.
+func handleJob[T any](app *application, kind string, fn func(T) error) {
+	handleTrackedJob(app, kind, func(_ *model.Job, v T) error {
+		return fn(v)
+	})
+}
+
+// handleTrackedJob is handleJob for jobs that need the job itself, to report their progress
+// or result.
+func handleTrackedJob[T any](app *application, kind string, fn func(*model.Job, T) error) {
+	app.jobHandlers[kind] = func(job *model.Job) error {
+		var v T
+		if err := json.Unmarshal(job.Payload, &v); err != nil {
+			return fmt.Errorf("decode payload: %w", err)
+		}
+		return fn(job, v)
+	}
+}
+
+// registerJobs registers the handlers of all kinds of jobs.
+func (app *application) registerJobs() {
+	handleJob(app, jobPurgeTrash, func(struct{}) error {
+		return app.purgeTrash()
+	})
+	handleJob(app, jobDeliverWebhooks, func(struct{}) error {
+		return app.deliverWebhooks()
+	})
+	handleJob(app, jobCleanupJobs, func(struct{}) error {
+		deleted, err := app.models.Jobs.DeleteSucceeded(jobRetention)
+		if deleted > 0 {
+			log.Printf("deleted %d succeeded jobs", deleted)
+		}
+		return err
+	})
+	handleJob(app, jobCleanupStale, func(struct{}) error {
+		return app.cleanupStaleData()
+	})
+	handleJob(app, jobSendReminders, func(struct{}) error {
+		reminded, err := app.models.Reminders.SendDue(app.config.reminders.offsets)
+		if reminded > 0 {
+			log.Printf("sent due date reminders for %d tasks", reminded)
+		}
+		return err
+	})
+	handleTrackedJob(app, jobCloneClassroom, app.runCloneJob)
+}
+
+// enqueue queues a job of the given kind with payload, to run at runAt or right away if runAt
+// is zero. A non-empty uniqueKey skips the job if one with the same key is already queued.
+func (app *application) enqueue(kind string, payload any, runAt time.Time, uniqueKey string) error {
+	js, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	job := &model.Job{
+		Kind:    kind,
+		Payload: js,
+		RunAt:   runAt,
+	}
+	if uniqueKey != "" {
+		job.UniqueKey = &uniqueKey
+	}
+
+	return app.models.Jobs.Enqueue(job)
+}
+
+// schedule queues a job of the given kind every interval. The kind is used as unique key, so
+// however many instances are running, at most one such job is queued at a time.
+func (app *application) schedule(interval time.Duration, kind string) {
+	app.every(interval, func() {
+		if err := app.enqueue(kind, struct{}{}, time.Time{}, kind); err != nil {
+			log.Printf("schedule %s: %s", kind, err)
+		}
+	})
+}
+
+// startWorkers starts n workers that run the queued jobs until the application shuts down.
+func (app *application) startWorkers(n int) {
+	for i := 0; i < n; i++ {
+		app.background(app.work)
+	}
+}
+
+// work runs due jobs one after another. When the application starts shutting down, the job
+// that is running is finished before the worker returns, so serve() waits for it.
+func (app *application) work() {
+	for {
+		select {
+		case <-app.quit:
+			return
+		default:
+		}
+
+		job, err := app.models.Jobs.Claim(jobLease)
+		if err != nil {
+			log.Println("claim job: " + err.Error())
+		}
+
+		if job == nil {
+			select {
+			case <-app.quit:
+				return
+			case <-time.After(jobPollInterval):
+			}
+			continue
+		}
+
+		app.runJob(job)
+	}
+}
+
+// runJob runs a claimed job and records the outcome.
+func (app *application) runJob(job *model.Job) {
+	err := app.callJobHandler(job)
+	if err == nil {
+		if err := app.models.Jobs.Complete(job); err != nil {
+			log.Printf("complete job %d: %s", job.Id, err)
+		}
+		return
+	}
+
+	log.Printf("job %d (%s) attempt %d failed: %s", job.Id, job.Kind, job.Attempts, err)
+
+	if err := app.models.Jobs.Fail(job, err); err != nil {
+		log.Printf("fail job %d: %s", job.Id, err)
+	}
+}
+
+// callJobHandler calls the handler of the job's kind, turning a panic into an error so that the
+// job is retried and the worker keeps running.
+func (app *application) callJobHandler(job *model.Job) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+
+	handler, ok := app.jobHandlers[job.Kind]
+	if !ok {
+		return fmt.Errorf("no handler for job kind %q", job.Kind)
+	}
+
+	return handler(job)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"log"
+	"net/http"
+	"time"
+)
+
+// cleanupBatchSize is how many rows one statement of the cleanup job deletes at most.
+const cleanupBatchSize = 1000
+
+// maintenanceMetrics holds the totals and the outcome of the last run of the cleanup job since
+// the process started.
+var maintenanceMetrics = expvar.NewMap("maintenance")
+
+// cleanupStaleData deletes expired tokens and the users who never activated their account
+// within the configured retention, and moves tasks that have belonged to no classroom for
+// longer than the configured retention to the trash. It runs periodically as a background job.
+func (app *application) cleanupStaleData() error {
+	start := time.Now()
+
+	tokens, tokensErr := app.models.Tokens.DeleteExpired(cleanupBatchSize)
+	users, usersErr := app.models.Users.DeleteUnactivated(app.config.cleanup.unactivatedRetention, cleanupBatchSize)
+
+	var tasks int64
+	var tasksErr error
+	if app.config.cleanup.orphanRetention > 0 {
+		tasks, tasksErr = app.models.Tasks.TrashOrphaned(app.config.cleanup.orphanRetention, cleanupBatchSize)
+	}
+
+	err := errors.Join(tokensErr, usersErr, tasksErr)
+
+	duration := time.Since(start)
+
+	maintenanceMetrics.Add("runs", 1)
+	maintenanceMetrics.Add("tokens_deleted", tokens)
+	maintenanceMetrics.Add("users_deleted", users)
+	maintenanceMetrics.Add("orphaned_tasks_trashed", tasks)
+
+	lastRun := new(expvar.String)
+	lastRun.Set(start.UTC().Format(time.RFC3339))
+	maintenanceMetrics.Set("last_run", lastRun)
+
+	lastDuration := new(expvar.Int)
+	lastDuration.Set(duration.Milliseconds())
+	maintenanceMetrics.Set("last_duration_ms", lastDuration)
+
+	lastError := new(expvar.String)
+	if err != nil {
+		maintenanceMetrics.Add("errors", 1)
+		lastError.Set(err.Error())
+	}
+	maintenanceMetrics.Set("last_error", lastError)
+
+	log.Printf("cleanup: deleted %d expired tokens and %d unactivated users, trashed %d orphaned tasks in %s", tokens, users, tasks, duration)
+
+	return err
+}
+
+func (app *application) maintenanceMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	app.writeJSON(w, http.StatusOK, envelope{"maintenance": json.RawMessage(maintenanceMetrics.String())}, nil)
+}
@@ -3,11 +3,41 @@ package main
 import (
 	"FinalProject/internal/classroom-app/model"
 	"FinalProject/internal/classroom-app/validator"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"net/http"
+	"regexp"
 	"strings"
+
+	"github.com/gorilla/websocket"
 )
 
+// requestIDRX matches the request ids accepted from the X-Request-ID header of a request.
+var requestIDRX = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// requestID makes sure every request has an id, which is echoed in the X-Request-ID response
+// header and recorded in the audit log. A well-formed id sent by the client or a proxy is
+// kept, otherwise a random one is generated.
+func (app *application) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validator.Matches(id, requestIDRX) {
+			b := make([]byte, 16)
+			if _, err := rand.Read(b); err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+			id = hex.EncodeToString(b)
+		}
+
+		w.Header().Set("X-Request-ID", id)
+		r = app.contextSetRequestID(r, id)
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *application) authenticate(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Add the "Vary: Authorization" header to the response. This indicates to any caches
@@ -18,6 +48,15 @@ func (app *application) authenticate(next http.Handler) http.Handler {
 		// empty string "" if there is no such header found.
 		authorizationHeader := r.Header.Get("Authorization")
 
+		// Browsers can't set headers on a WebSocket handshake, so they send the token as the
+		// second of the subprotocols "bearer" and "<token>" instead.
+		if authorizationHeader == "" && websocket.IsWebSocketUpgrade(r) {
+			protocols := websocket.Subprotocols(r)
+			if len(protocols) == 2 && protocols[0] == "bearer" {
+				authorizationHeader = "Bearer " + protocols[1]
+			}
+		}
+
 		// If there is no Authorization header found, use the contextSetUser() helper to add
 		// an AnonymousUser to the request context. Then we call the next handler in the chain
 		// and return without executing any of the code below.
@@ -133,3 +172,46 @@ func (app *application) requirePermissions(code string, next http.HandlerFunc) h
 	// Wrap this with the requireActivatedUser middleware before returning
 	return app.requireActivatedUser(fn)
 }
+
+// requireWritableClass rejects requests that would change the classroom of the id parameter
+// while it is archived, which makes it read-only.
+func (app *application) requireWritableClass(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		// Leave invalid ids for the handler to reject.
+		if id, err := app.readIDParam(r); err == nil {
+			archived, err := app.models.Classrooms.IsArchived(id)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			if archived {
+				app.archivedResponse(w, r)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
+
+// requireWritableTask rejects requests that would change the task of the id parameter while
+// it belongs to an archived classroom.
+func (app *application) requireWritableTask(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if id, err := app.readIDParam(r); err == nil {
+			archived, err := app.models.Tasks.InArchivedClassroom(id)
+			if err != nil {
+				app.serverErrorResponse(w, r, err)
+				return
+			}
+
+			if archived {
+				app.archivedResponse(w, r)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	}
+}
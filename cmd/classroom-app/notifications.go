@@ -0,0 +1,36 @@
+package main
+
+import (
+	"FinalProject/internal/classroom-app/model"
+	"log"
+	"net/http"
+)
+
+// notify notifies the members of the classroom, or of the classrooms of the task, who have the
+// given permission about an event caused by the user of the request. Like emitEvent, failures
+// are logged but don't fail the request.
+func (app *application) notify(r *http.Request, event, entityType string, entityID int, title, permission string) {
+	var actorID *int
+	if user := app.contextGetUser(r); !user.IsAnonymous() {
+		actorID = &user.Id
+	}
+
+	app.notifyAs(actorID, event, entityType, entityID, title, permission)
+}
+
+// notifyAs is notify for changes that weren't made by a request, like the ones of background
+// jobs. actorID is the user the change was made for, if any.
+func (app *application) notifyAs(actorID *int, event, entityType string, entityID int, title, permission string) {
+	notification := &model.Notification{
+		Event:      event,
+		EntityType: entityType,
+		EntityID:   entityID,
+		Title:      title,
+		ActorID:    actorID,
+	}
+
+	err := app.models.Notifications.Notify(notification, permission)
+	if err != nil {
+		log.Printf("notify %s of %s %d: %s", event, entityType, entityID, err)
+	}
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"FinalProject/internal/classroom-app/model"
+	"FinalProject/internal/classroom-app/validator"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// saveQuizHandler turns a task into a quiz or changes its settings. The questions are only
+// replaced if they are in the request, so the settings of a quiz can be changed after students
+// attempted it.
+func (app *application) saveQuizHandler(w http.ResponseWriter, r *http.Request) {
+	taskId, err := app.readIDParam(r)
+	if err != nil || taskId < 1 {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var input struct {
+		TimeLimitMinutes *int       `json:"timeLimitMinutes"`
+		MaxAttempts      *int       `json:"maxAttempts"`
+		ShuffleQuestions bool       `json:"shuffleQuestions"`
+		ShuffleOptions   bool       `json:"shuffleOptions"`
+		ClosesAt         *time.Time `json:"closesAt"`
+		Questions        []struct {
+			Kind    string           `json:"kind"`
+			Prompt  string           `json:"prompt"`
+			Points  int              `json:"points"`
+			Options []string         `json:"options"`
+			Key     *model.AnswerKey `json:"key"`
+		} `json:"questions"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	quiz := &model.Quiz{
+		TaskId:           taskId,
+		TimeLimitMinutes: input.TimeLimitMinutes,
+		MaxAttempts:      input.MaxAttempts,
+		ShuffleQuestions: input.ShuffleQuestions,
+		ShuffleOptions:   input.ShuffleOptions,
+		ClosesAt:         input.ClosesAt,
+	}
+	for _, in := range input.Questions {
+		question := &model.Question{Kind: in.Kind, Prompt: in.Prompt, Points: in.Points, Key: in.Key}
+		for i, option := range in.Options {
+			question.Options = append(question.Options, model.QuizOption{Id: i, Text: option})
+		}
+		quiz.Questions = append(quiz.Questions, question)
+	}
+
+	replaceQuestions := input.Questions != nil
+
+	v := validator.New()
+	if model.ValidateQuiz(v, quiz, replaceQuestions); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Quizzes.Save(quiz, replaceQuestions, app.contextGetActor(r))
+	if err != nil {
+		app.quizErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(quiz.Version))
+
+	app.writeJSON(w, http.StatusOK, envelope{"quiz": quiz}, headers)
+}
+
+// getQuizHandler returns the quiz of a task. The answer keys are only in it for the teachers of
+// the task's classrooms, or for everyone once the quiz has closed.
+func (app *application) getQuizHandler(w http.ResponseWriter, r *http.Request) {
+	taskId, err := app.readIDParam(r)
+	if err != nil || taskId < 1 {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	quiz, err := app.models.Quizzes.Get(taskId, false)
+	if err != nil {
+		app.quizErrorResponse(w, r, err)
+		return
+	}
+
+	withKeys, err := app.canSeeQuizKeys(r, quiz)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	if withKeys {
+		quiz, err = app.models.Quizzes.Get(taskId, true)
+		if err != nil {
+			app.quizErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"quiz": quiz}, nil)
+}
+
+// deleteQuizHandler turns a quiz back into a plain task, deleting its attempts.
+func (app *application) deleteQuizHandler(w http.ResponseWriter, r *http.Request) {
+	taskId, err := app.readIDParam(r)
+	if err != nil || taskId < 1 {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Quizzes.Delete(taskId, app.contextGetActor(r))
+	if err != nil {
+		app.quizErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"result": "Success"}, nil)
+}
+
+// startQuizAttemptHandler starts an attempt of the user at the quiz of a task, or returns the
+// attempt they are still in.
+func (app *application) startQuizAttemptHandler(w http.ResponseWriter, r *http.Request) {
+	taskId, err := app.readIDParam(r)
+	if err != nil || taskId < 1 {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	attempt, err := app.models.Quizzes.StartAttempt(taskId, app.contextGetUser(r).Id)
+	if err != nil {
+		app.quizErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"attempt": attempt}, nil)
+}
+
+// listQuizAttemptsHandler returns the attempts of the user at the quiz of a task.
+func (app *application) listQuizAttemptsHandler(w http.ResponseWriter, r *http.Request) {
+	taskId, err := app.readIDParam(r)
+	if err != nil || taskId < 1 {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if _, err := app.models.Quizzes.Get(taskId, false); err != nil {
+		app.quizErrorResponse(w, r, err)
+		return
+	}
+
+	attempts, err := app.models.Quizzes.GetAttempts(taskId, app.contextGetUser(r).Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"attempts": attempts}, nil)
+}
+
+// getQuizAttemptHandler returns an attempt to the user who made it or to the teachers of the
+// task's classrooms, with which answers were correct once it is submitted and the keys may be
+// seen.
+func (app *application) getQuizAttemptHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil || id < 1 {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	attempt, err := app.models.Quizzes.GetAttempt(id, false)
+	if err != nil {
+		app.quizErrorResponse(w, r, err)
+		return
+	}
+
+	quiz, err := app.models.Quizzes.Get(attempt.TaskId, false)
+	if err != nil {
+		app.quizErrorResponse(w, r, err)
+		return
+	}
+
+	user := app.contextGetUser(r)
+	teacher, err := app.teachesQuiz(r, attempt.TaskId)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if attempt.UserID != user.Id && !teacher {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if teacher || quiz.Closed() {
+		attempt, err = app.models.Quizzes.GetAttempt(id, true)
+		if err != nil {
+			app.quizErrorResponse(w, r, err)
+			return
+		}
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"attempt": attempt}, nil)
+}
+
+// submitQuizAttemptHandler grades the answers of the user's attempt, keyed by question id: an
+// option id for single questions, a list of option ids for multi questions, a number for
+// numeric questions and a text for text questions.
+func (app *application) submitQuizAttemptHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil || id < 1 {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var input struct {
+		Answers map[int]json.RawMessage `json:"answers"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Answers == nil {
+		input.Answers = map[int]json.RawMessage{}
+	}
+
+	attempt, err := app.models.Quizzes.SubmitAttempt(id, app.contextGetUser(r).Id, input.Answers)
+	if err != nil {
+		app.quizErrorResponse(w, r, err)
+		return
+	}
+
+	app.emitEvent(model.EventQuizSubmitted, envelope{
+		"taskId":    attempt.TaskId,
+		"userId":    attempt.UserID,
+		"attemptId": attempt.Id,
+		"number":    attempt.Number,
+		"score":     attempt.Score,
+		"maxScore":  attempt.MaxScore,
+	})
+
+	app.writeJSON(w, http.StatusOK, envelope{"attempt": attempt}, nil)
+}
+
+// quizResultsHandler returns the best score of every student who attempted the quiz of a task
+// to the teachers of its classrooms.
+func (app *application) quizResultsHandler(w http.ResponseWriter, r *http.Request) {
+	taskId, err := app.readIDParam(r)
+	if err != nil || taskId < 1 {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if _, err := app.models.Quizzes.Get(taskId, false); err != nil {
+		app.quizErrorResponse(w, r, err)
+		return
+	}
+
+	teacher, err := app.teachesQuiz(r, taskId)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+	if !teacher {
+		app.notPermittedResponse(w, r)
+		return
+	}
+
+	results, err := app.models.Quizzes.Results(taskId)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"results": results}, nil)
+}
+
+// canSeeQuizKeys reports whether the user may see the answer keys of the quiz: its teachers
+// always, everyone else once the quiz has closed.
+func (app *application) canSeeQuizKeys(r *http.Request, quiz *model.Quiz) (bool, error) {
+	if quiz.Closed() {
+		return true, nil
+	}
+	return app.teachesQuiz(r, quiz.TaskId)
+}
+
+// teachesQuiz reports whether the user is a teacher of one of the classrooms of the task; the
+// global task:write permission alone doesn't give access to the answers of every quiz.
+func (app *application) teachesQuiz(r *http.Request, taskId int) (bool, error) {
+	return app.models.Members.TeachesTask(taskId, app.contextGetUser(r).Id)
+}
+
+func (app *application) quizErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	var fieldErrors model.FieldErrors
+	switch {
+	case errors.Is(err, model.ErrRecordNotFound):
+		app.notFoundResponse(w, r)
+	case errors.Is(err, model.ErrArchived):
+		app.archivedResponse(w, r)
+	case errors.Is(err, model.ErrNotStudent):
+		app.notPermittedResponse(w, r)
+	case errors.Is(err, model.ErrQuizClosed):
+		app.quizClosedResponse(w, r)
+	case errors.Is(err, model.ErrAttemptLimit):
+		app.attemptLimitResponse(w, r)
+	case errors.Is(err, model.ErrAttemptOver):
+		app.attemptOverResponse(w, r)
+	case errors.Is(err, model.ErrQuizAttempted):
+		app.quizAttemptedResponse(w, r)
+	case errors.As(err, &fieldErrors):
+		app.failedValidationResponse(w, r, fieldErrors)
+	default:
+		app.serverErrorResponse(w, r, err)
+	}
+}
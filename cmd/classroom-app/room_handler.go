@@ -0,0 +1,186 @@
+package main
+
+import (
+	"FinalProject/internal/classroom-app/model"
+	"FinalProject/internal/classroom-app/validator"
+	"errors"
+	"net/http"
+)
+
+func (app *application) createRoomHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Name     string `json:"name"`
+		Capacity int    `json:"capacity"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	room := &model.Room{
+		Name:     input.Name,
+		Capacity: input.Capacity,
+	}
+
+	v := validator.New()
+	if model.ValidateRoom(v, room); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Rooms.Insert(room, app.contextGetActor(r))
+	if err != nil {
+		var fieldErrors model.FieldErrors
+		switch {
+		case errors.As(err, &fieldErrors):
+			app.failedValidationResponse(w, r, fieldErrors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(room.Version))
+
+	app.writeJSON(w, http.StatusCreated, envelope{"room": room}, headers)
+}
+
+func (app *application) listRoomsHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		model.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readStrings(qs, "sort", "name")
+
+	input.Filters.SortSafeList = []string{"name"}
+
+	if model.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	rooms, metadata, err := app.models.Rooms.GetAll(input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"rooms": rooms, "metadata": metadata}, nil)
+}
+
+func (app *application) getRoomHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil || id < 1 {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	room, err := app.models.Rooms.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"room": room}, nil)
+}
+
+func (app *application) updateRoomHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil || id < 1 {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	room, err := app.models.Rooms.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !app.ifMatch(r, etag(room.Version)) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Name     *string `json:"name"`
+		Capacity *int    `json:"capacity"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Name != nil {
+		room.Name = *input.Name
+	}
+	if input.Capacity != nil {
+		room.Capacity = *input.Capacity
+	}
+
+	v := validator.New()
+	if model.ValidateRoom(v, room); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Rooms.Update(room, app.contextGetActor(r))
+	if err != nil {
+		var fieldErrors model.FieldErrors
+		switch {
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.As(err, &fieldErrors):
+			app.failedValidationResponse(w, r, fieldErrors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(room.Version))
+
+	app.writeJSON(w, http.StatusOK, envelope{"room": room}, headers)
+}
+
+// deleteRoomHandler deletes a room. Its sessions are kept and no longer have a room.
+func (app *application) deleteRoomHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil || id < 1 {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Rooms.Delete(id, app.contextGetActor(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"result": "Success"}, nil)
+}
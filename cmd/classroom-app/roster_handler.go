@@ -0,0 +1,241 @@
+package main
+
+import (
+	"FinalProject/internal/classroom-app/model"
+	"FinalProject/internal/classroom-app/validator"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// maxRosterRows is the largest roster that can be imported in one request.
+const maxRosterRows = 1000
+
+// rosterColumns are the columns of a roster CSV file, in the order they are exported.
+var rosterColumns = []string{"first_name", "last_name", "email", "role"}
+
+// importRosterHandler enrolls the people of a CSV roster in a classroom. The first row must be
+// a header naming the columns; role is optional and defaults to student, and unknown columns
+// are ignored. Missing users are created unactivated. Every row is validated before anything
+// is written, and if any row is invalid nothing is imported. With ?dry_run=true the response
+// shows what would happen without changing anything. Only teachers of the classroom may import
+// into it.
+func (app *application) importRosterHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil || id < 1 {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if !app.requireTeacher(w, r, id) {
+		return
+	}
+
+	v := validator.New()
+
+	dryRun := false
+	if s := r.URL.Query().Get("dry_run"); s != "" {
+		dryRun, err = strconv.ParseBool(s)
+		v.Check(err == nil, "dry_run", "must be a boolean value")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1_048_576)
+
+	reader := csv.NewReader(r.Body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		switch {
+		case errors.Is(err, io.EOF):
+			app.badRequestResponse(w, r, errors.New("roster must not be empty"))
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	for _, name := range rosterColumns[:3] {
+		if _, ok := columns[name]; !ok {
+			app.badRequestResponse(w, r, fmt.Errorf("roster is missing the %q column", name))
+			return
+		}
+	}
+
+	field := func(record []string, name string) string {
+		i, ok := columns[name]
+		if !ok || i >= len(record) {
+			return ""
+		}
+		return csvUnescape(strings.TrimSpace(record[i]))
+	}
+
+	// Hashing a password is slow on purpose, so all new users share one unusable password
+	// instead of hashing one for each row.
+	var pending model.User
+	if err := pending.Password.SetUnusable(); err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	var entries []*model.RosterEntry
+	var invalid []*model.RosterResult
+	seen := make(map[string]int)
+
+	for row := 2; ; row++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		if len(entries)+len(invalid) == maxRosterRows {
+			app.badRequestResponse(w, r, fmt.Errorf("roster must not have more than %d rows", maxRosterRows))
+			return
+		}
+
+		user := &model.User{
+			FirstName: field(record, "first_name"),
+			LastName:  field(record, "last_name"),
+			Email:     field(record, "email"),
+			Password:  pending.Password,
+		}
+
+		role := strings.ToLower(field(record, "role"))
+		if role == "" {
+			role = model.RoleStudent
+		}
+
+		rv := validator.New()
+		model.ValidateUser(rv, user)
+		rv.Check(role == model.RoleStudent || role == model.RoleTeacher, "role", "must be student or teacher")
+		// Emails are case-insensitive, like the email column of users.
+		email := strings.ToLower(user.Email)
+		if first, ok := seen[email]; ok && email != "" {
+			rv.AddError("email", fmt.Sprintf("duplicates row %d", first))
+		} else {
+			seen[email] = row
+		}
+
+		if !rv.Valid() {
+			invalid = append(invalid, &model.RosterResult{
+				Row:    row,
+				Email:  user.Email,
+				Role:   role,
+				Status: model.RosterInvalid,
+				Errors: rv.Errors,
+			})
+			continue
+		}
+
+		entries = append(entries, &model.RosterEntry{Row: row, User: user, Role: role})
+	}
+
+	if len(invalid) > 0 {
+		app.errorResponse(w, r, http.StatusUnprocessableEntity, envelope{"rows": invalid})
+		return
+	}
+
+	results, err := app.models.Members.ImportRoster(id, entries, dryRun, app.contextGetActor(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, model.ErrArchived):
+			app.archivedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	summary := make(map[string]int)
+	for _, result := range results {
+		summary[result.Status]++
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"dry_run": dryRun, "rows": results, "summary": summary}, nil)
+}
+
+// exportRosterHandler sends the members of a classroom as a CSV file that can be imported
+// again, with an extra column telling whether each member has activated their account. Cells
+// that spreadsheets would take for formulas are escaped, and the import undoes that. Only
+// teachers of the classroom may export it.
+func (app *application) exportRosterHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil || id < 1 {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if _, err := app.models.Classrooms.Get(id); err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if !app.requireTeacher(w, r, id) {
+		return
+	}
+
+	members, err := app.models.Members.GetAll(id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="class-%d-roster.csv"`, id))
+
+	writer := csv.NewWriter(w)
+	writer.Write(append(rosterColumns, "activated"))
+	for _, member := range members {
+		writer.Write([]string{
+			csvCell(member.FirstName),
+			csvCell(member.LastName),
+			csvCell(member.Email),
+			member.Role,
+			strconv.FormatBool(member.Activated),
+		})
+	}
+	writer.Flush()
+
+	if err := writer.Error(); err != nil {
+		app.logError(r, err)
+	}
+}
+
+// requireTeacher checks that the user is a teacher of the classroom; the global class:write
+// permission alone doesn't give access to the roster or attendance of every classroom. Users
+// become teachers by creating the classroom or through a clone or roster import. It sends an
+// error response and returns false otherwise.
+func (app *application) requireTeacher(w http.ResponseWriter, r *http.Request, classId int) bool {
+	role, err := app.models.Members.GetRole(classId, app.contextGetUser(r).Id)
+	switch {
+	case errors.Is(err, model.ErrRecordNotFound):
+		app.notPermittedResponse(w, r)
+		return false
+	case err != nil:
+		app.serverErrorResponse(w, r, err)
+		return false
+	case role != model.RoleTeacher:
+		app.notPermittedResponse(w, r)
+		return false
+	}
+	return true
+}
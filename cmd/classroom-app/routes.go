@@ -24,26 +24,152 @@ func (app *application) routes() http.Handler {
 	// Get list of classrooms
 	api.HandleFunc("/classes", app.requireActivatedUser(app.getClassesList)).Methods("GET")
 	// Update class
-	api.HandleFunc("/class/{id}", app.requireActivatedUser(app.updateClassHandler)).Methods("PUT")
+	api.HandleFunc("/class/{id}", app.requireActivatedUser(app.requireWritableClass(app.updateClassHandler))).Methods("PUT")
+	// Patch class
+	api.HandleFunc("/class/{id}", app.requireActivatedUser(app.requireWritableClass(app.patchClassHandler))).Methods("PATCH")
 	// Delete class
-	api.HandleFunc("/class/{id}", app.requirePermissions("class:write", app.deleteClassHandler)).Methods("DELETE")
+	api.HandleFunc("/class/{id}", app.requirePermissions("class:write", app.requireWritableClass(app.deleteClassHandler))).Methods("DELETE")
+	// Restore deleted class
+	api.HandleFunc("/class/{id}/restore", app.requirePermissions("class:write", app.restoreClassHandler)).Methods("POST")
+	// Archive a class, which makes it read-only, or unarchive it
+	api.HandleFunc("/class/{id}/archive", app.requirePermissions("class:write", app.archiveClassHandler)).Methods("POST")
+	api.HandleFunc("/class/{id}/unarchive", app.requirePermissions("class:write", app.unarchiveClassHandler)).Methods("POST")
+	// Clone a class, for example into a new term
+	api.HandleFunc("/class/{id}/clone", app.requirePermissions("class:write", app.cloneClassHandler)).Methods("POST")
+	// Weekly sessions of a class
+	api.HandleFunc("/class/{id}/sessions", app.requireActivatedUser(app.listClassSessionsHandler)).Methods("GET")
+	api.HandleFunc("/class/{id}/sessions", app.requirePermissions("class:write", app.requireWritableClass(app.createSessionHandler))).Methods("POST")
+	api.HandleFunc("/session/{id}", app.requireActivatedUser(app.getSessionHandler)).Methods("GET")
+	api.HandleFunc("/session/{id}", app.requirePermissions("class:write", app.updateSessionHandler)).Methods("PUT")
+	api.HandleFunc("/session/{id}", app.requirePermissions("class:write", app.deleteSessionHandler)).Methods("DELETE")
+	// Attendance of the students at one session on one date, and check-in codes for it
+	api.HandleFunc("/session/{id}/attendance/{date:[0-9]{4}-[0-9]{2}-[0-9]{2}}", app.requirePermissions("class:write", app.getAttendanceHandler)).Methods("GET")
+	api.HandleFunc("/session/{id}/attendance/{date:[0-9]{4}-[0-9]{2}-[0-9]{2}}", app.requirePermissions("class:write", app.recordAttendanceHandler)).Methods("PUT")
+	api.HandleFunc("/session/{id}/attendance/{date:[0-9]{4}-[0-9]{2}-[0-9]{2}}/code", app.requirePermissions("class:write", app.createCheckInCodeHandler)).Methods("POST")
+	// Check in to a session with a code shown in class
+	api.HandleFunc("/attendance/check-in", app.requireActivatedUser(app.checkInHandler)).Methods("POST")
+	// Attendance rates of the students of a class, and all attendance as CSV
+	api.HandleFunc("/class/{id}/attendance", app.requirePermissions("class:write", app.attendanceSummaryHandler)).Methods("GET")
+	api.HandleFunc("/class/{id}/attendance/export", app.requirePermissions("class:write", app.exportAttendanceHandler)).Methods("GET")
+	// Sessions of the classes of the user, day by day
+	api.HandleFunc("/timetable", app.requireActivatedUser(app.timetableHandler)).Methods("GET")
+	// List, create, get, update and delete rooms
+	api.HandleFunc("/rooms", app.requireActivatedUser(app.listRoomsHandler)).Methods("GET")
+	api.HandleFunc("/rooms", app.requirePermissions("class:write", app.createRoomHandler)).Methods("POST")
+	api.HandleFunc("/room/{id}", app.requireActivatedUser(app.getRoomHandler)).Methods("GET")
+	api.HandleFunc("/room/{id}", app.requirePermissions("class:write", app.updateRoomHandler)).Methods("PUT")
+	api.HandleFunc("/room/{id}", app.requirePermissions("class:write", app.deleteRoomHandler)).Methods("DELETE")
 	// Get tasks of a class
 	api.HandleFunc("/class/{id}/tasks", app.requireActivatedUser(app.getTasksForClass)).Methods("GET")
+	// Import a CSV roster into a class
+	api.HandleFunc("/class/{id}/roster/import", app.requirePermissions("class:write", app.requireWritableClass(app.importRosterHandler))).Methods("POST")
+	// Export the roster of a class as CSV
+	api.HandleFunc("/class/{id}/roster/export", app.requirePermissions("class:write", app.exportRosterHandler)).Methods("GET")
+	// Stream task events of a class
+	api.HandleFunc("/class/{id}/events", app.requirePermissions("task:read", app.classEventsHandler)).Methods("GET")
+
+	// List, create, get, update and delete academic terms
+	api.HandleFunc("/terms", app.requireActivatedUser(app.listTermsHandler)).Methods("GET")
+	api.HandleFunc("/terms", app.requirePermissions("class:write", app.createTermHandler)).Methods("POST")
+	api.HandleFunc("/term/{id}", app.requireActivatedUser(app.getTermHandler)).Methods("GET")
+	api.HandleFunc("/term/{id}", app.requirePermissions("class:write", app.updateTermHandler)).Methods("PUT")
+	api.HandleFunc("/term/{id}", app.requirePermissions("class:write", app.deleteTermHandler)).Methods("DELETE")
 
 	// Create Task
 	api.HandleFunc("/task", app.requirePermissions("task:write", app.createTaskHandler)).Methods("POST")
 	// Get Task
 	api.HandleFunc("/task/{id}", app.requirePermissions("task:read", app.getTaskHandler)).Methods("GET")
 	// Update Task
-	api.HandleFunc("/task/{id}", app.requirePermissions("task:write", app.updateTaskHandler)).Methods("PUT")
+	api.HandleFunc("/task/{id}", app.requirePermissions("task:write", app.requireWritableTask(app.updateTaskHandler))).Methods("PUT")
+	// Patch Task
+	api.HandleFunc("/task/{id}", app.requirePermissions("task:write", app.requireWritableTask(app.patchTaskHandler))).Methods("PATCH")
 	// Delete Task
-	api.HandleFunc("/task/{id}", app.requirePermissions("task:write", app.deleteTaskHandler)).Methods("DELETE")
+	api.HandleFunc("/task/{id}", app.requirePermissions("task:write", app.requireWritableTask(app.deleteTaskHandler))).Methods("DELETE")
+
+	// List the classrooms of a task
+	api.HandleFunc("/task/{id}/classes", app.requirePermissions("task:read", app.getTaskClassesHandler)).Methods("GET")
+	// Share a task with more classrooms
+	api.HandleFunc("/task/{id}/classes", app.requirePermissions("task:write", app.requireWritableTask(app.attachTaskClassesHandler))).Methods("POST")
+	// Remove a task from a classroom
+	api.HandleFunc("/task/{id}/class/{classId:[0-9]+}", app.requirePermissions("task:write", app.requireWritableTask(app.detachTaskClassHandler))).Methods("DELETE")
+	// Restore deleted Task
+	api.HandleFunc("/task/{id}/restore", app.requirePermissions("task:write", app.restoreTaskHandler)).Methods("POST")
+	// Copy a task into classrooms as independent tasks
+	api.HandleFunc("/task/{id}/copy", app.requirePermissions("task:write", app.copyTaskHandler)).Methods("POST")
+	// Save a task as a template
+	api.HandleFunc("/task/{id}/template", app.requirePermissions("task:write", app.saveTaskAsTemplateHandler)).Methods("POST")
+
+	// Turn a task into a quiz, get and delete its quiz
+	api.HandleFunc("/task/{id}/quiz", app.requirePermissions("task:write", app.requireWritableTask(app.saveQuizHandler))).Methods("PUT")
+	api.HandleFunc("/task/{id}/quiz", app.requirePermissions("task:read", app.getQuizHandler)).Methods("GET")
+	api.HandleFunc("/task/{id}/quiz", app.requirePermissions("task:write", app.requireWritableTask(app.deleteQuizHandler))).Methods("DELETE")
+	// Start and list the user's attempts at a quiz, get and submit an attempt
+	api.HandleFunc("/task/{id}/quiz/attempts", app.requirePermissions("task:read", app.startQuizAttemptHandler)).Methods("POST")
+	api.HandleFunc("/task/{id}/quiz/attempts", app.requirePermissions("task:read", app.listQuizAttemptsHandler)).Methods("GET")
+	api.HandleFunc("/quiz/attempt/{id}", app.requirePermissions("task:read", app.getQuizAttemptHandler)).Methods("GET")
+	api.HandleFunc("/quiz/attempt/{id}/submit", app.requirePermissions("task:read", app.submitQuizAttemptHandler)).Methods("POST")
+	// Best score of every student at a quiz
+	api.HandleFunc("/task/{id}/quiz/results", app.requirePermissions("task:write", app.quizResultsHandler)).Methods("GET")
+
+	// List, create, get, update and delete task templates
+	api.HandleFunc("/templates", app.requirePermissions("task:read", app.listTemplatesHandler)).Methods("GET")
+	api.HandleFunc("/templates", app.requirePermissions("task:write", app.createTemplateHandler)).Methods("POST")
+	api.HandleFunc("/template/{id}", app.requirePermissions("task:read", app.getTemplateHandler)).Methods("GET")
+	api.HandleFunc("/template/{id}", app.requirePermissions("task:write", app.updateTemplateHandler)).Methods("PUT")
+	api.HandleFunc("/template/{id}", app.requirePermissions("task:write", app.deleteTemplateHandler)).Methods("DELETE")
+	// Create tasks from a template
+	api.HandleFunc("/template/{id}/instantiate", app.requirePermissions("task:write", app.instantiateTemplateHandler)).Methods("POST")
+
+	// List classrooms and tasks deleted by the user
+	api.HandleFunc("/trash", app.requireActivatedUser(app.listTrashHandler)).Methods("GET")
+
+	// Audit log of all changes
+	api.HandleFunc("/audit", app.requirePermissions("audit:read", app.listAuditHandler)).Methods("GET")
+
+	// Webhooks
+	api.HandleFunc("/webhook", app.requirePermissions("webhook:write", app.createWebhookHandler)).Methods("POST")
+	api.HandleFunc("/webhooks", app.requirePermissions("webhook:write", app.listWebhooksHandler)).Methods("GET")
+	api.HandleFunc("/webhook/{id}", app.requirePermissions("webhook:write", app.deleteWebhookHandler)).Methods("DELETE")
+	api.HandleFunc("/webhook/{id}/deliveries", app.requirePermissions("webhook:write", app.listWebhookDeliveriesHandler)).Methods("GET")
+	api.HandleFunc("/webhook/delivery/{id}/redeliver", app.requirePermissions("webhook:write", app.redeliverWebhookHandler)).Methods("POST")
+
+	// Background jobs, to inspect and retry dead ones
+	api.HandleFunc("/jobs", app.requirePermissions("job:admin", app.listJobsHandler)).Methods("GET")
+	api.HandleFunc("/job/{id}", app.requireActivatedUser(app.getJobHandler)).Methods("GET")
+	api.HandleFunc("/job/{id}/retry", app.requirePermissions("job:admin", app.retryJobHandler)).Methods("POST")
+	// Metrics of the maintenance jobs
+	api.HandleFunc("/maintenance", app.requirePermissions("job:admin", app.maintenanceMetricsHandler)).Methods("GET")
+
+	// iCalendar feeds of task due dates, authenticated by the calendar token in the URL
+	api.HandleFunc("/calendar/{token:[A-Z2-7]+}.ics", app.calendarFeedHandler).Methods("GET")
+	api.HandleFunc("/calendar/{token:[A-Z2-7]+}/class/{id}.ics", app.calendarFeedHandler).Methods("GET")
+	api.HandleFunc("/calendar/{token:[A-Z2-7]+}/timetable.ics", app.timetableFeedHandler).Methods("GET")
+	// Rotate or revoke the calendar token of the user
+	api.HandleFunc("/calendar/token", app.requireActivatedUser(app.rotateCalendarTokenHandler)).Methods("POST")
+	api.HandleFunc("/calendar/token", app.requireActivatedUser(app.revokeCalendarTokenHandler)).Methods("DELETE")
+
+	// Notifications of the user
+	api.HandleFunc("/notifications", app.requireActivatedUser(app.listNotificationsHandler)).Methods("GET")
+	api.HandleFunc("/notifications/unread", app.requireActivatedUser(app.unreadNotificationsHandler)).Methods("GET")
+	api.HandleFunc("/notifications/read", app.requireActivatedUser(app.markAllNotificationsReadHandler)).Methods("POST")
+	api.HandleFunc("/notifications/{id}/read", app.requireActivatedUser(app.markNotificationReadHandler)).Methods("POST")
+	api.HandleFunc("/notifications/preferences", app.requireActivatedUser(app.getNotificationPreferencesHandler)).Methods("GET")
+	api.HandleFunc("/notifications/preferences", app.requireActivatedUser(app.updateNotificationPreferencesHandler)).Methods("PUT")
+
+	// WebSocket for live events, presence and typing indicators
+	api.HandleFunc("/ws", app.requirePermissions("task:read", app.websocketHandler)).Methods("GET")
+
+	// Create, update and delete classrooms and tasks in one request
+	api.HandleFunc("/batch", app.requireActivatedUser(app.batchHandler)).Methods("POST")
+	// Search classrooms and tasks
+	api.HandleFunc("/search", app.requireActivatedUser(app.searchHandler)).Methods("GET")
 
 	// User handlers with Authentication
 	api.HandleFunc("/user", app.registerUserHandler).Methods("POST")
 	api.HandleFunc("/user/activated", app.activateUserHandler).Methods("PUT")
+	api.HandleFunc("/user/invitation", app.acceptInvitationHandler).Methods("PUT")
 	api.HandleFunc("/user/login", app.createAuthenticationTokenHandler).Methods("POST")
 
 	// Wrap the router with the panic recovery middleware and rate limit middleware.
-	return app.authenticate(r)
+	return app.requestID(app.authenticate(r))
 }
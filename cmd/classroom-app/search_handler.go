@@ -0,0 +1,50 @@
+package main
+
+import (
+	"FinalProject/internal/classroom-app/model"
+	"FinalProject/internal/classroom-app/validator"
+	"net/http"
+)
+
+func (app *application) searchHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Query string
+		model.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Query = app.readStrings(qs, "q", "")
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readStrings(qs, "sort", "-rank")
+
+	input.Filters.SortSafeList = []string{"-rank"}
+
+	model.ValidateSearchQuery(v, input.Query)
+	if model.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	// Only search the entity types the caller is allowed to read.
+	user := app.contextGetUser(r)
+	permissions, err := app.models.Permissions.GetAllForUser(user.Id)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	scope := model.SearchScope{
+		Classrooms: permissions.Include("class:read"),
+		Tasks:      permissions.Include("task:read"),
+	}
+
+	results, metadata, err := app.models.Search.Search(input.Query, scope, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"results": results, "metadata": metadata}, nil)
+}
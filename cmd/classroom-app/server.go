@@ -22,6 +22,9 @@ func (app *application) serve() error {
 		WriteTimeout: 30 * time.Second,
 	}
 
+	// Shutdown doesn't wait for event streams by itself, so end them as soon as it starts.
+	srv.RegisterOnShutdown(app.broker.Close)
+
 	shutdownError := make(chan error)
 
 	go func() {
@@ -43,6 +46,10 @@ func (app *application) serve() error {
 			shutdownError <- err
 		}
 
+		// Tell the periodic background jobs and the job workers to stop. Workers finish the
+		// job they are running first; jobs that are still queued stay in the database.
+		close(app.quit)
+
 		// Log a message to say that we're waiting for any background goroutines to complete
 		// their tasks.
 		log.Print("completing background tasks", map[string]string{
@@ -57,6 +64,8 @@ func (app *application) serve() error {
 
 	}()
 
+	app.startBackgroundJobs()
+
 	// Log a "starting server" message.
 	log.Println("starting server", map[string]string{
 		"addr": srv.Addr,
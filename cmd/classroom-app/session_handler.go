@@ -0,0 +1,265 @@
+package main
+
+import (
+	"FinalProject/internal/classroom-app/model"
+	"FinalProject/internal/classroom-app/validator"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// maxTimetableDays is the longest date range a timetable can be asked for.
+const maxTimetableDays = 92
+
+// createSessionHandler adds a weekly session to a classroom.
+func (app *application) createSessionHandler(w http.ResponseWriter, r *http.Request) {
+	classId, err := app.readIDParam(r)
+	if err != nil || classId < 1 {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var input struct {
+		RoomId     *int     `json:"roomId"`
+		Weekday    int      `json:"weekday"`
+		StartsAt   string   `json:"startsAt"`
+		EndsAt     string   `json:"endsAt"`
+		StartsOn   string   `json:"startsOn"`
+		EndsOn     string   `json:"endsOn"`
+		Exceptions []string `json:"exceptions"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	session := &model.ClassSession{
+		ClassId:    classId,
+		RoomId:     input.RoomId,
+		Weekday:    input.Weekday,
+		StartsAt:   input.StartsAt,
+		EndsAt:     input.EndsAt,
+		StartsOn:   input.StartsOn,
+		EndsOn:     input.EndsOn,
+		Exceptions: input.Exceptions,
+	}
+
+	v := validator.New()
+	if model.ValidateClassSession(v, session); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Sessions.Insert(session, app.contextGetActor(r))
+	if err != nil {
+		app.sessionErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(session.Version))
+	headers.Set("Location", fmt.Sprintf("/api/v1/session/%d", session.Id))
+
+	app.writeJSON(w, http.StatusCreated, envelope{"session": session}, headers)
+}
+
+func (app *application) listClassSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	classId, err := app.readIDParam(r)
+	if err != nil || classId < 1 {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if _, err := app.models.Classrooms.Get(classId); err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	sessions, err := app.models.Sessions.GetAllOfClass(classId)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"sessions": sessions}, nil)
+}
+
+func (app *application) getSessionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil || id < 1 {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	session, err := app.models.Sessions.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"session": session}, nil)
+}
+
+// updateSessionHandler changes a session. A roomId of 0 takes it out of its room.
+func (app *application) updateSessionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil || id < 1 {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	session, err := app.models.Sessions.Get(id)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if !app.ifMatch(r, etag(session.Version)) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		RoomId     *int     `json:"roomId"`
+		Weekday    *int     `json:"weekday"`
+		StartsAt   *string  `json:"startsAt"`
+		EndsAt     *string  `json:"endsAt"`
+		StartsOn   *string  `json:"startsOn"`
+		EndsOn     *string  `json:"endsOn"`
+		Exceptions []string `json:"exceptions"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.RoomId != nil {
+		session.RoomId = input.RoomId
+		if *input.RoomId == 0 {
+			session.RoomId = nil
+		}
+	}
+	if input.Weekday != nil {
+		session.Weekday = *input.Weekday
+	}
+	if input.StartsAt != nil {
+		session.StartsAt = *input.StartsAt
+	}
+	if input.EndsAt != nil {
+		session.EndsAt = *input.EndsAt
+	}
+	if input.StartsOn != nil {
+		session.StartsOn = *input.StartsOn
+	}
+	if input.EndsOn != nil {
+		session.EndsOn = *input.EndsOn
+	}
+	if input.Exceptions != nil {
+		session.Exceptions = input.Exceptions
+	}
+
+	v := validator.New()
+	if model.ValidateClassSession(v, session); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Sessions.Update(session, app.contextGetActor(r))
+	if err != nil {
+		app.sessionErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(session.Version))
+
+	app.writeJSON(w, http.StatusOK, envelope{"session": session}, headers)
+}
+
+func (app *application) deleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil || id < 1 {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	err = app.models.Sessions.Delete(id, app.contextGetActor(r))
+	if err != nil {
+		app.sessionErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"result": "Success"}, nil)
+}
+
+func (app *application) sessionErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	var fieldErrors model.FieldErrors
+	switch {
+	case errors.Is(err, model.ErrRecordNotFound):
+		app.notFoundResponse(w, r)
+	case errors.Is(err, model.ErrEditConflict):
+		app.editConflictResponse(w, r)
+	case errors.Is(err, model.ErrArchived):
+		app.archivedResponse(w, r)
+	case errors.Is(err, model.ErrRoomBooked):
+		app.roomBookedResponse(w, r)
+	case errors.As(err, &fieldErrors):
+		app.failedValidationResponse(w, r, fieldErrors)
+	default:
+		app.serverErrorResponse(w, r, err)
+	}
+}
+
+// timetableHandler returns the sessions of the classrooms the user is a member of, one entry per
+// day a session takes place on, from the date from to the date to. By default it covers the
+// seven days starting today.
+func (app *application) timetableHandler(w http.ResponseWriter, r *http.Request) {
+	v := validator.New()
+	qs := r.URL.Query()
+
+	from := app.readTime(qs, "from", v)
+	to := app.readTime(qs, "to", v)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	if from.IsZero() {
+		from = time.Now().UTC().Truncate(24 * time.Hour)
+	}
+	if to.IsZero() {
+		to = from.AddDate(0, 0, 6)
+	}
+
+	v.Check(!to.Before(from), "to", "must not be before from")
+	v.Check(to.Sub(from) < maxTimetableDays*24*time.Hour, "to", fmt.Sprintf("must be less than %d days after from", maxTimetableDays))
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	fromDate, toDate := from.Format("2006-01-02"), to.Format("2006-01-02")
+
+	entries, err := app.models.Sessions.Timetable(app.contextGetUser(r).Id, fromDate, toDate)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"from": fromDate, "to": toDate, "timetable": entries}, nil)
+}
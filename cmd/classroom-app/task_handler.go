@@ -5,15 +5,21 @@ import (
 	"FinalProject/internal/classroom-app/validator"
 	"database/sql"
 	"errors"
+	jsonpatch "github.com/evanphx/json-patch/v5"
 	"log"
 	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
 )
 
 func (app *application) createTaskHandler(w http.ResponseWriter, r *http.Request) {
 	var input struct {
-		Header       string `json:"header"`
-		Description  string `json:"description"`
-		ClassroomIds []int  `json:"classrooms"`
+		Header       string     `json:"header"`
+		Description  string     `json:"description"`
+		DueAt        *time.Time `json:"dueAt"`
+		ClassroomIds []int      `json:"classrooms"`
 	}
 
 	err := app.readJSON(w, r, &input)
@@ -25,6 +31,7 @@ func (app *application) createTaskHandler(w http.ResponseWriter, r *http.Request
 	task := &model.Task{
 		Header:      input.Header,
 		Description: input.Description,
+		DueAt:       input.DueAt,
 	}
 
 	v := validator.New()
@@ -33,12 +40,26 @@ func (app *application) createTaskHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = app.models.Tasks.Insert(task, input.ClassroomIds...)
+	err = app.models.Tasks.Insert(task, app.contextGetActor(r), input.ClassroomIds...)
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		var fieldErrors model.FieldErrors
+		switch {
+		case errors.As(err, &fieldErrors):
+			app.failedValidationResponse(w, r, fieldErrors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
-	app.writeJSON(w, http.StatusCreated, envelope{"task": task}, nil)
+
+	app.emitEvent(model.EventTaskCreated, envelope{"task": task, "classrooms": input.ClassroomIds})
+	app.publishClassEvent(streamTaskCreated, task, input.ClassroomIds...)
+	app.notify(r, model.EventTaskCreated, model.EntityTask, task.Id, "New task: "+task.Header, "task:read")
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(task.Version))
+
+	app.writeJSON(w, http.StatusCreated, envelope{"task": task}, headers)
 }
 
 func (app *application) getTaskHandler(w http.ResponseWriter, r *http.Request) {
@@ -57,6 +78,10 @@ func (app *application) getTaskHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if app.notModified(w, r, etag(task.Version), parseTimestamp(task.UpdatedAt)) {
+		return
+	}
+
 	app.writeJSON(w, http.StatusOK, envelope{"task": task}, nil)
 }
 
@@ -76,9 +101,15 @@ func (app *application) updateTaskHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	if !app.ifMatch(r, etag(task.Version)) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
 	var input struct {
-		Header      *string `json:"header"`
-		Description *string `json:"description"`
+		Header      *string    `json:"header"`
+		Description *string    `json:"description"`
+		DueAt       *time.Time `json:"dueAt"`
 	}
 
 	err = app.readJSON(w, r, &input)
@@ -93,6 +124,9 @@ func (app *application) updateTaskHandler(w http.ResponseWriter, r *http.Request
 	if input.Description != nil {
 		task.Description = *input.Description
 	}
+	if input.DueAt != nil {
+		task.DueAt = input.DueAt
+	}
 
 	v := validator.New()
 	if model.ValidateTask(v, task); !v.Valid() {
@@ -100,13 +134,96 @@ func (app *application) updateTaskHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = app.models.Tasks.Update(task)
+	err = app.models.Tasks.Update(task, app.contextGetActor(r))
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, model.ErrArchived):
+			app.archivedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
 		return
 	}
 
-	app.writeJSON(w, http.StatusOK, envelope{"task": task}, nil)
+	app.emitEvent(model.EventTaskUpdated, task)
+	app.publishTaskEvent(streamTaskUpdated, task, task.Id)
+	app.notify(r, model.EventTaskUpdated, model.EntityTask, task.Id, "Task updated: "+task.Header, "task:read")
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(task.Version))
+
+	app.writeJSON(w, http.StatusOK, envelope{"task": task}, headers)
+}
+
+func (app *application) patchTaskHandler(w http.ResponseWriter, r *http.Request) {
+	taskId, err := app.readIDParam(r)
+	if err != nil || taskId < 1 {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	task, err := app.models.Tasks.Get(taskId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Task with ID %d not found", taskId)
+		}
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	if !app.ifMatch(r, etag(task.Version)) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	var patched model.Task
+	err = app.readPatch(w, r, task, &patched)
+	if err != nil {
+		switch {
+		case errors.Is(err, errUnsupportedPatchType):
+			app.unsupportedPatchTypeResponse(w, r)
+		case errors.Is(err, jsonpatch.ErrTestFailed):
+			app.editConflictResponse(w, r)
+		default:
+			app.badRequestResponse(w, r, err)
+		}
+		return
+	}
+
+	v := validator.New()
+	v.Check(patched.Id == task.Id, "id", "cannot be modified")
+	v.Check(patched.CreatedAt == task.CreatedAt, "createdAt", "cannot be modified")
+	v.Check(patched.UpdatedAt == task.UpdatedAt, "UpdatedAt", "cannot be modified")
+	v.Check(patched.Version == task.Version, "version", "cannot be modified")
+
+	if model.ValidateTask(v, &patched); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Tasks.Update(&patched, app.contextGetActor(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, model.ErrArchived):
+			app.archivedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.emitEvent(model.EventTaskUpdated, patched)
+	app.publishTaskEvent(streamTaskUpdated, patched, patched.Id)
+	app.notify(r, model.EventTaskUpdated, model.EntityTask, patched.Id, "Task updated: "+patched.Header, "task:read")
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(patched.Version))
+
+	app.writeJSON(w, http.StatusOK, envelope{"task": patched}, headers)
 }
 
 func (app *application) deleteTaskHandler(w http.ResponseWriter, r *http.Request) {
@@ -116,11 +233,37 @@ func (app *application) deleteTaskHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	err = app.models.Tasks.Delete(taskId)
+	// Only look the task up when the client asked for a conditional delete.
+	version := 0
+	if r.Header.Get("If-Match") != "" {
+		task, err := app.models.Tasks.Get(taskId)
+		if err != nil {
+			app.notFoundResponse(w, r)
+			return
+		}
+
+		if !app.ifMatch(r, etag(task.Version)) {
+			app.preconditionFailedResponse(w, r)
+			return
+		}
+		version = task.Version
+	}
+
+	err = app.models.Tasks.Delete(taskId, version, app.contextGetActor(r))
 	if err != nil {
-		app.serverErrorResponse(w, r, err)
+		switch {
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		case errors.Is(err, model.ErrArchived):
+			app.archivedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
 	}
 
+	app.publishTaskEvent(streamTaskDeleted, envelope{"id": taskId}, taskId)
+
 	app.writeJSON(w, http.StatusOK, envelope{"result": "Success"}, nil)
 }
 
@@ -142,12 +285,23 @@ func (app *application) getTasksForClass(w http.ResponseWriter, r *http.Request)
 	input.Filters.Page = app.readInt(qs, "page", 1, v)
 	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
 	input.Filters.Sort = app.readStrings(qs, "sort", "id")
+	input.Filters.Cursor = app.readStrings(qs, "cursor", "")
+	input.Filters.Filter = app.readStrings(qs, "filter", "")
 
 	input.Filters.SortSafeList = []string{
 		"id", "date",
 		"-id", "-date",
 	}
 
+	input.Filters.FilterSafeList = map[string]model.FilterField{
+		"id":          {Column: "t.id", Type: model.FilterInt},
+		"header":      {Column: "t.header", Type: model.FilterText},
+		"description": {Column: "t.description", Type: model.FilterText},
+		"created_at":  {Column: "t.created_at", Type: model.FilterTime},
+		"updated_at":  {Column: "t.updated_at", Type: model.FilterTime},
+		"due_at":      {Column: "t.due_at", Type: model.FilterTime},
+	}
+
 	if model.ValidateFilters(v, input.Filters); !v.Valid() {
 		app.failedValidationResponse(w, r, v.Errors)
 		return
@@ -160,5 +314,124 @@ func (app *application) getTasksForClass(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	tag := []any{metadata.TotalRecords, metadata.NextCursor}
+	for _, task := range *tasks {
+		tag = append(tag, task.Id, task.Version)
+	}
+	if app.notModified(w, r, weakETag(tag...), time.Time{}) {
+		return
+	}
+
 	app.writeJSON(w, http.StatusOK, envelope{"tasks": tasks, "metadata": metadata}, nil)
 }
+
+// getTaskClassesHandler lists the classrooms a task is used in. A task that is used in none is
+// flagged as orphaned; it is moved to the trash once it has been orphaned for longer than the
+// configured retention.
+func (app *application) getTaskClassesHandler(w http.ResponseWriter, r *http.Request) {
+	taskId, err := app.readIDParam(r)
+	if err != nil || taskId < 1 {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	classrooms, err := app.models.Tasks.GetClassrooms(taskId)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"classrooms": classrooms, "orphaned": len(classrooms) == 0}, nil)
+}
+
+// attachTaskClassesHandler shares a task with more classrooms. Classrooms it already belongs to
+// are left as they are.
+func (app *application) attachTaskClassesHandler(w http.ResponseWriter, r *http.Request) {
+	taskId, err := app.readIDParam(r)
+	if err != nil || taskId < 1 {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var input struct {
+		ClassroomIds []int `json:"classrooms"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+	v.Check(len(input.ClassroomIds) > 0, "classrooms", "must be provided")
+	v.Check(len(input.ClassroomIds) <= 100, "classrooms", "must not have more than 100 classrooms")
+	for _, classId := range input.ClassroomIds {
+		v.Check(classId > 0, "classrooms", "must be valid classroom ids")
+	}
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	attached, err := app.models.Tasks.Attach(taskId, input.ClassroomIds, app.contextGetActor(r))
+	if err != nil {
+		var fieldErrors model.FieldErrors
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, model.ErrArchived):
+			app.archivedResponse(w, r)
+		case errors.As(err, &fieldErrors):
+			app.failedValidationResponse(w, r, fieldErrors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	if len(attached) > 0 {
+		if task, err := app.models.Tasks.Get(taskId); err == nil {
+			app.publishClassEvent(streamTaskAttached, task, attached...)
+		}
+	}
+
+	app.getTaskClassesHandler(w, r)
+}
+
+// detachTaskClassHandler removes a task from a classroom.
+func (app *application) detachTaskClassHandler(w http.ResponseWriter, r *http.Request) {
+	taskId, err := app.readIDParam(r)
+	if err != nil || taskId < 1 {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	classId, err := strconv.Atoi(mux.Vars(r)["classId"])
+	if err != nil || classId < 1 {
+		app.badRequestResponse(w, r, errors.New("invalid classId parameter"))
+		return
+	}
+
+	err = app.models.Tasks.Detach(taskId, classId, app.contextGetActor(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.Is(err, model.ErrArchived):
+			app.archivedResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.publishClassEvent(streamTaskDetached, envelope{"id": taskId}, classId)
+
+	app.getTaskClassesHandler(w, r)
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"FinalProject/internal/classroom-app/model"
+	"FinalProject/internal/classroom-app/validator"
+	"errors"
+	"net/http"
+	"time"
+)
+
+func (app *application) createTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Header      string     `json:"header"`
+		Description string     `json:"description"`
+		DueAt       *time.Time `json:"dueAt"`
+		Shared      bool       `json:"shared"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	template := &model.TaskTemplate{
+		OwnerID:     app.contextGetUser(r).Id,
+		Shared:      input.Shared,
+		Header:      input.Header,
+		Description: input.Description,
+		DueAt:       input.DueAt,
+	}
+
+	app.insertTemplate(w, r, template)
+}
+
+// saveTaskAsTemplateHandler saves a copy of a task as a template of the user.
+func (app *application) saveTaskAsTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	taskId, err := app.readIDParam(r)
+	if err != nil || taskId < 1 {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var input struct {
+		Shared bool `json:"shared"`
+	}
+
+	err = app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	task, err := app.models.Tasks.Get(taskId)
+	if err != nil {
+		app.notFoundResponse(w, r)
+		return
+	}
+
+	template := &model.TaskTemplate{
+		OwnerID:     app.contextGetUser(r).Id,
+		Shared:      input.Shared,
+		Header:      task.Header,
+		Description: task.Description,
+		DueAt:       task.DueAt,
+	}
+
+	app.insertTemplate(w, r, template)
+}
+
+func (app *application) insertTemplate(w http.ResponseWriter, r *http.Request, template *model.TaskTemplate) {
+	v := validator.New()
+	if model.ValidateTaskTemplate(v, template); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err := app.models.Templates.Insert(template, app.contextGetActor(r))
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(template.Version))
+
+	app.writeJSON(w, http.StatusCreated, envelope{"template": template}, headers)
+}
+
+func (app *application) listTemplatesHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Scope string
+		model.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Scope = app.readStrings(qs, "scope", model.TemplatesAll)
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readStrings(qs, "sort", "header")
+
+	input.Filters.SortSafeList = []string{"header"}
+
+	model.ValidateTemplateScope(v, input.Scope)
+	if model.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	templates, metadata, err := app.models.Templates.GetAll(user.Id, input.Scope, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"templates": templates, "metadata": metadata}, nil)
+}
+
+func (app *application) getTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	template, ok := app.readTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	if app.notModified(w, r, etag(template.Version), template.UpdatedAt) {
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"template": template}, nil)
+}
+
+// updateTemplateHandler changes a template. Only its owner can change it.
+func (app *application) updateTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	template, ok := app.readOwnTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	if !app.ifMatch(r, etag(template.Version)) {
+		app.preconditionFailedResponse(w, r)
+		return
+	}
+
+	var input struct {
+		Header      *string    `json:"header"`
+		Description *string    `json:"description"`
+		DueAt       *time.Time `json:"dueAt"`
+		Shared      *bool      `json:"shared"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if input.Header != nil {
+		template.Header = *input.Header
+	}
+	if input.Description != nil {
+		template.Description = *input.Description
+	}
+	if input.DueAt != nil {
+		template.DueAt = input.DueAt
+	}
+	if input.Shared != nil {
+		template.Shared = *input.Shared
+	}
+
+	v := validator.New()
+	if model.ValidateTaskTemplate(v, template); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	err = app.models.Templates.Update(template, app.contextGetActor(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrEditConflict):
+			app.editConflictResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(template.Version))
+
+	app.writeJSON(w, http.StatusOK, envelope{"template": template}, headers)
+}
+
+// deleteTemplateHandler deletes a template. Only its owner can delete it, and the tasks made
+// from it are kept.
+func (app *application) deleteTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	template, ok := app.readOwnTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.models.Templates.Delete(template.Id, app.contextGetActor(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"result": "Success"}, nil)
+}
+
+// instantiateTemplateHandler creates a task from a template in each of the given classrooms.
+func (app *application) instantiateTemplateHandler(w http.ResponseWriter, r *http.Request) {
+	template, ok := app.readTemplate(w, r)
+	if !ok {
+		return
+	}
+
+	classroomIds, offset, ok := app.readCopyInput(w, r)
+	if !ok {
+		return
+	}
+
+	tasks, err := app.models.Templates.Instantiate(template, classroomIds, offset, app.contextGetActor(r))
+	app.tasksCopiedResponse(w, r, tasks, err)
+}
+
+// copyTaskHandler copies a task into each of the given classrooms. Unlike sharing the task
+// with them, every classroom gets a task of its own that can be changed independently.
+func (app *application) copyTaskHandler(w http.ResponseWriter, r *http.Request) {
+	taskId, err := app.readIDParam(r)
+	if err != nil || taskId < 1 {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	classroomIds, offset, ok := app.readCopyInput(w, r)
+	if !ok {
+		return
+	}
+
+	tasks, err := app.models.Tasks.Copy(taskId, classroomIds, offset, app.contextGetActor(r))
+	app.tasksCopiedResponse(w, r, tasks, err)
+}
+
+// readCopyInput reads the classrooms to create tasks in and the offset to shift their due
+// dates by, a duration like "168h" that may be negative. It sends an error response and returns
+// false if the input is invalid.
+func (app *application) readCopyInput(w http.ResponseWriter, r *http.Request) ([]int, time.Duration, bool) {
+	var input struct {
+		ClassroomIds []int  `json:"classrooms"`
+		Offset       string `json:"offset"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return nil, 0, false
+	}
+
+	v := validator.New()
+	v.Check(len(input.ClassroomIds) > 0, "classrooms", "must be provided")
+	v.Check(len(input.ClassroomIds) <= 100, "classrooms", "must not have more than 100 classrooms")
+	for _, classId := range input.ClassroomIds {
+		v.Check(classId > 0, "classrooms", "must be valid classroom ids")
+	}
+
+	var offset time.Duration
+	if input.Offset != "" {
+		offset, err = time.ParseDuration(input.Offset)
+		v.Check(err == nil, "offset", "must be a duration like 168h")
+	}
+
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return nil, 0, false
+	}
+	return input.ClassroomIds, offset, true
+}
+
+func (app *application) tasksCopiedResponse(w http.ResponseWriter, r *http.Request, tasks []*model.Task, err error) {
+	if err != nil {
+		var fieldErrors model.FieldErrors
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		case errors.As(err, &fieldErrors):
+			app.failedValidationResponse(w, r, fieldErrors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	for _, task := range tasks {
+		classIds, err := app.models.Tasks.GetClassroomIds(task.Id)
+		if err != nil {
+			app.logError(r, err)
+			continue
+		}
+
+		app.emitEvent(model.EventTaskCreated, envelope{"task": task, "classrooms": classIds})
+		app.publishClassEvent(streamTaskCreated, task, classIds...)
+		app.notify(r, model.EventTaskCreated, model.EntityTask, task.Id, "New task: "+task.Header, "task:read")
+	}
+
+	app.writeJSON(w, http.StatusCreated, envelope{"tasks": tasks}, nil)
+}
+
+// readTemplate reads the template of the id parameter if the user can see it. It sends an
+// error response and returns false otherwise.
+func (app *application) readTemplate(w http.ResponseWriter, r *http.Request) (*model.TaskTemplate, bool) {
+	id, err := app.readIDParam(r)
+	if err != nil || id < 1 {
+		app.badRequestResponse(w, r, err)
+		return nil, false
+	}
+
+	template, err := app.models.Templates.Get(id, app.contextGetUser(r).Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return nil, false
+	}
+	return template, true
+}
+
+// readOwnTemplate is readTemplate for changes, which only the owner of a template can make.
+func (app *application) readOwnTemplate(w http.ResponseWriter, r *http.Request) (*model.TaskTemplate, bool) {
+	template, ok := app.readTemplate(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	if template.OwnerID != app.contextGetUser(r).Id {
+		app.notPermittedResponse(w, r)
+		return nil, false
+	}
+	return template, true
+}
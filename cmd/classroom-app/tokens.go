@@ -51,7 +51,10 @@ func (app *application) createAuthenticationTokenHandler(w http.ResponseWriter,
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.Id, 24*time.Hour, model.ScopeAuthentication)
+	actor := app.contextGetActor(r)
+	actor.UserID = user.Id
+
+	token, err := app.models.Tokens.New(user.Id, 24*time.Hour, model.ScopeAuthentication, actor)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
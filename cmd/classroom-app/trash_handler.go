@@ -0,0 +1,106 @@
+package main
+
+import (
+	"FinalProject/internal/classroom-app/model"
+	"FinalProject/internal/classroom-app/validator"
+	"errors"
+	"log"
+	"net/http"
+)
+
+func (app *application) listTrashHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		model.Filters
+	}
+	v := validator.New()
+	qs := r.URL.Query()
+
+	input.Filters.Page = app.readInt(qs, "page", 1, v)
+	input.Filters.PageSize = app.readInt(qs, "page_size", 20, v)
+	input.Filters.Sort = app.readStrings(qs, "sort", "-deleted_at")
+
+	input.Filters.SortSafeList = []string{"-deleted_at"}
+
+	if model.ValidateFilters(v, input.Filters); !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user := app.contextGetUser(r)
+
+	items, metadata, err := app.models.Trash.GetAllForUser(user.Id, input.Filters)
+	if err != nil {
+		app.serverErrorResponse(w, r, err)
+		return
+	}
+
+	for _, item := range items {
+		item.PurgeAt = item.DeletedAt.Add(app.config.trash.retention)
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"trash": items, "metadata": metadata}, nil)
+}
+
+func (app *application) restoreClassHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := app.readIDParam(r)
+	if err != nil || id < 1 {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	classroom, err := app.models.Classrooms.Restore(id, app.contextGetActor(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(classroom.Version))
+
+	app.writeJSON(w, http.StatusOK, envelope{"classroom": classroom}, headers)
+}
+
+func (app *application) restoreTaskHandler(w http.ResponseWriter, r *http.Request) {
+	taskId, err := app.readIDParam(r)
+	if err != nil || taskId < 1 {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	task, err := app.models.Tasks.Restore(taskId, app.contextGetActor(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			app.notFoundResponse(w, r)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.publishTaskEvent(streamTaskRestored, task, task.Id)
+
+	headers := make(http.Header)
+	headers.Set("ETag", etag(task.Version))
+
+	app.writeJSON(w, http.StatusOK, envelope{"task": task}, headers)
+}
+
+// purgeTrash permanently deletes everything that has been in the trash for longer than the
+// configured retention period. It runs periodically as a background job.
+func (app *application) purgeTrash() error {
+	purged, err := app.models.Trash.Purge(app.config.trash.retention)
+	if err != nil {
+		return err
+	}
+
+	if purged > 0 {
+		log.Printf("purged %d records from the trash", purged)
+	}
+	return nil
+}
@@ -41,7 +41,10 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = app.models.Users.Insert(user)
+	// The user registers themselves, so they are the actor of everything below once they exist.
+	actor := app.contextGetActor(r)
+
+	err = app.models.Users.Insert(user, actor)
 	if err != nil {
 		switch {
 		case errors.Is(err, model.ErrDuplicateEmail):
@@ -54,13 +57,15 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = app.models.Permissions.AddForUser(user.Id, "class:read")
+	actor.UserID = user.Id
+
+	err = app.models.Permissions.AddForUser(user.Id, actor, model.DefaultPermissions...)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
-	token, err := app.models.Tokens.New(user.Id, 3*24*time.Hour, model.ScopeActivation)
+	token, err := app.models.Tokens.New(user.Id, 3*24*time.Hour, model.ScopeActivation, actor)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
@@ -109,18 +114,63 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 
 	user.Activated = true
 
-	err = app.models.Users.Update(user)
+	actor := app.contextGetActor(r)
+	actor.UserID = user.Id
+
+	err = app.models.Users.Update(user, actor)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
 	// If everything went successfully above, then delete all activation tokens for the user.
-	err = app.models.Tokens.DeleteAllForUser(model.ScopeActivation, user.Id)
+	err = app.models.Tokens.DeleteAllForUser(model.ScopeActivation, user.Id, actor)
 	if err != nil {
 		app.serverErrorResponse(w, r, err)
 		return
 	}
 
+	app.emitEvent(model.EventUserActivated, user)
+
+	app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
+}
+
+// acceptInvitationHandler lets a user created by a roster import set their password with the
+// invitation code their teacher gave them, which also activates their account.
+func (app *application) acceptInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		TokenPlaintext string `json:"token"`
+		Password       string `json:"password"`
+	}
+
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	v := validator.New()
+
+	model.ValidateTokenPlaintext(v, input.TokenPlaintext)
+	model.ValidatePasswordPlaintext(v, input.Password)
+	if !v.Valid() {
+		app.failedValidationResponse(w, r, v.Errors)
+		return
+	}
+
+	user, err := app.models.Users.AcceptInvitation(input.TokenPlaintext, input.Password, app.contextGetActor(r))
+	if err != nil {
+		switch {
+		case errors.Is(err, model.ErrRecordNotFound):
+			v.AddError("token", "invalid or expired invitation code")
+			app.failedValidationResponse(w, r, v.Errors)
+		default:
+			app.serverErrorResponse(w, r, err)
+		}
+		return
+	}
+
+	app.emitEvent(model.EventUserActivated, user)
+
 	app.writeJSON(w, http.StatusOK, envelope{"user": user}, nil)
 }
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"FinalProject/internal/classroom-app/model"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// webhookClient sends webhook deliveries. Receivers get 10 seconds to answer.
+var webhookClient = &http.Client{Timeout: 10 * time.Second}
+
+// emitEvent queues a webhook delivery of the event for every webhook subscribed to it. Failing
+// to queue the event must not fail the request that caused it, so errors are only logged.
+func (app *application) emitEvent(event string, data any) {
+	err := app.models.Webhooks.Enqueue(event, data)
+	if err != nil {
+		log.Printf("enqueue webhook event %s: %s", event, err)
+		return
+	}
+
+	// Send the deliveries right away instead of waiting for the next scheduled run.
+	err = app.enqueue(jobDeliverWebhooks, struct{}{}, time.Time{}, jobDeliverWebhooks)
+	if err != nil {
+		log.Printf("enqueue %s: %s", jobDeliverWebhooks, err)
+	}
+}
+
+// deliverWebhooks sends the webhook deliveries that are due. It runs as a background job, and
+// stops early when the application starts shutting down. Failed deliveries are retried by the
+// delivery log itself, so they don't fail the job.
+func (app *application) deliverWebhooks() error {
+	for {
+		deliveries, err := app.models.Webhooks.ClaimDue(20, time.Minute)
+		if err != nil {
+			return err
+		}
+
+		for _, delivery := range deliveries {
+			statusCode, err := app.sendWebhook(delivery)
+
+			err = app.models.Webhooks.RecordAttempt(delivery, statusCode, err)
+			if err != nil {
+				log.Println("record webhook delivery: " + err.Error())
+			}
+		}
+
+		if len(deliveries) < 20 {
+			return nil
+		}
+
+		select {
+		case <-app.quit:
+			return nil
+		default:
+		}
+	}
+}
+
+// sendWebhook POSTs a delivery to its webhook. The body is signed with HMAC-SHA256 over
+// "<timestamp>.<body>" using the webhook secret, so receivers can verify both where it came
+// from and, by rejecting old timestamps, that it isn't being replayed. Any non-2xx response
+// counts as a failure.
+func (app *application) sendWebhook(delivery *model.WebhookDelivery) (int, error) {
+	body, err := json.Marshal(map[string]any{
+		"id":         delivery.Id,
+		"event":      delivery.Event,
+		"created_at": delivery.CreatedAt,
+		"data":       delivery.Payload,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(delivery.Secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	signature := hex.EncodeToString(mac.Sum(nil))
+
+	ctx, cancel := context.WithTimeout(context.Background(), webhookClient.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "classroom-app-webhooks/"+version)
+	req.Header.Set("X-Webhook-Id", strconv.FormatInt(delivery.Id, 10))
+	req.Header.Set("X-Webhook-Event", delivery.Event)
+	req.Header.Set("X-Webhook-Timestamp", timestamp)
+	req.Header.Set("X-Webhook-Signature", "sha256="+signature)
+
+	res, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+
+	// Drain a bit of the body so the connection can be reused.
+	io.Copy(io.Discard, io.LimitReader(res.Body, 64<<10))
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("receiver responded with %s", res.Status)
+	}
+
+	return res.StatusCode, nil
+}
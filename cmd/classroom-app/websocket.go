@@ -0,0 +1,482 @@
+package main
+
+import (
+	"FinalProject/internal/classroom-app/broker"
+	"FinalProject/internal/classroom-app/model"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Limits of a WebSocket connection.
+const (
+	wsMaxConnsPerUser = 5
+	wsMaxClassrooms   = 20
+	wsMaxViewing      = 10
+	wsMaxMessageSize  = 4096
+
+	// wsSendBuffer is how many messages may wait to be written to a client. A client that
+	// falls further behind is disconnected instead of holding up the others.
+	wsSendBuffer = 64
+
+	// Clients may send wsMessageRate messages per second on average, in bursts of up to
+	// wsMessageBurst.
+	wsMessageRate  = 10
+	wsMessageBurst = 20
+
+	// wsTypingInterval is the minimum time between two typing indicators of a connection for
+	// the same task.
+	wsTypingInterval = 2 * time.Second
+
+	wsPingInterval = 30 * time.Second
+	wsPongWait     = 60 * time.Second
+	wsWriteWait    = 10 * time.Second
+)
+
+// Types of the messages exchanged over a WebSocket connection.
+const (
+	wsSubscribe    = "subscribe"
+	wsUnsubscribe  = "unsubscribe"
+	wsView         = "view"
+	wsLeave        = "leave"
+	wsTyping       = "typing"
+	wsSubscribed   = "subscribed"
+	wsUnsubscribed = "unsubscribed"
+	wsEvent        = "event"
+	wsPresence     = "presence"
+	wsError        = "error"
+)
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// Browsers can't set the Authorization header on a WebSocket, so they offer the
+	// subprotocols "bearer" and the token instead, see authenticate.
+	Subprotocols: []string{"bearer"},
+	// Connections authenticate with a bearer token rather than a cookie, so a page on another
+	// origin can't open one on behalf of a user.
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// wsUser is how a user appears to other users in presence and typing messages.
+type wsUser struct {
+	Id        int    `json:"id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+// wsIncoming is a message sent by a client.
+type wsIncoming struct {
+	Type      string `json:"type"`
+	Classroom int    `json:"classroom"`
+	Task      int    `json:"task"`
+}
+
+// wsOutgoing is a message sent to a client.
+type wsOutgoing struct {
+	Type      string          `json:"type"`
+	Classroom int             `json:"classroom,omitempty"`
+	Task      int             `json:"task,omitempty"`
+	Event     *broker.Event   `json:"event,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+// wsHub keeps track of the open WebSocket connections of this instance: how many each user has
+// open and who is viewing which task.
+type wsHub struct {
+	mu    sync.Mutex
+	conns map[int]int
+	// viewers maps a task id to the users viewing it and their number of connections doing so.
+	viewers map[int]map[wsUser]int
+}
+
+func newWSHub() *wsHub {
+	return &wsHub{
+		conns:   make(map[int]int),
+		viewers: make(map[int]map[wsUser]int),
+	}
+}
+
+// connect registers a new connection of the user. It returns false if the user already has
+// the maximum number of connections open.
+func (h *wsHub) connect(userId int) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.conns[userId] >= wsMaxConnsPerUser {
+		return false
+	}
+	h.conns[userId]++
+	return true
+}
+
+func (h *wsHub) disconnect(userId int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.conns[userId]--
+	if h.conns[userId] <= 0 {
+		delete(h.conns, userId)
+	}
+}
+
+// view marks the user as viewing the task and returns everyone viewing it.
+func (h *wsHub) view(taskId int, user wsUser) []wsUser {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.viewers[taskId] == nil {
+		h.viewers[taskId] = make(map[wsUser]int)
+	}
+	h.viewers[taskId][user]++
+	return h.viewing(taskId)
+}
+
+// leave marks the user as no longer viewing the task and returns everyone still viewing it.
+func (h *wsHub) leave(taskId int, user wsUser) []wsUser {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.viewers[taskId][user]--
+	if h.viewers[taskId][user] <= 0 {
+		delete(h.viewers[taskId], user)
+	}
+	if len(h.viewers[taskId]) == 0 {
+		delete(h.viewers, taskId)
+	}
+	return h.viewing(taskId)
+}
+
+// viewing returns the users viewing the task, ordered by id. h.mu must be held.
+func (h *wsHub) viewing(taskId int) []wsUser {
+	users := []wsUser{}
+	for user := range h.viewers[taskId] {
+		users = append(users, user)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Id < users[j].Id })
+	return users
+}
+
+// wsClient is one WebSocket connection.
+type wsClient struct {
+	app  *application
+	conn *websocket.Conn
+	user wsUser
+
+	send      chan wsOutgoing
+	done      chan struct{}
+	closeOnce sync.Once
+
+	mu         sync.Mutex
+	classrooms map[int]*broker.Subscription
+	viewing    map[int]*broker.Subscription
+
+	// Only used by the read loop.
+	lastTyping map[int]time.Time
+	tokens     float64
+	lastRead   time.Time
+}
+
+func newWSClient(app *application, conn *websocket.Conn, user *model.User) *wsClient {
+	return &wsClient{
+		app:        app,
+		conn:       conn,
+		user:       wsUser{Id: user.Id, FirstName: user.FirstName, LastName: user.LastName},
+		send:       make(chan wsOutgoing, wsSendBuffer),
+		done:       make(chan struct{}),
+		classrooms: make(map[int]*broker.Subscription),
+		viewing:    make(map[int]*broker.Subscription),
+		lastTyping: make(map[int]time.Time),
+		tokens:     wsMessageBurst,
+		lastRead:   time.Now(),
+	}
+}
+
+// run serves the connection until it is closed by either side.
+func (c *wsClient) run() {
+	defer c.cleanup()
+
+	go c.writeLoop()
+
+	// Like event streams, connections are closed after a while so that clients authenticate
+	// again.
+	lifetime := time.AfterFunc(streamLifetime, func() {
+		c.close(websocket.CloseNormalClosure, "connection expired, reconnect")
+	})
+	defer lifetime.Stop()
+
+	c.conn.SetReadLimit(wsMaxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				log.Printf("websocket of user %d: %s", c.user.Id, err)
+			}
+			c.close(websocket.CloseNormalClosure, "")
+			return
+		}
+
+		if !c.allow() {
+			c.queue(wsOutgoing{Type: wsError, Error: "rate limit exceeded"})
+			continue
+		}
+
+		var msg wsIncoming
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.queue(wsOutgoing{Type: wsError, Error: "message must be a JSON object"})
+			continue
+		}
+
+		c.handle(msg)
+	}
+}
+
+// allow reports whether the client is within its message rate, using a token bucket.
+func (c *wsClient) allow() bool {
+	now := time.Now()
+	c.tokens = min(wsMessageBurst, c.tokens+now.Sub(c.lastRead).Seconds()*wsMessageRate)
+	c.lastRead = now
+
+	if c.tokens < 1 {
+		return false
+	}
+	c.tokens--
+	return true
+}
+
+func (c *wsClient) handle(msg wsIncoming) {
+	switch msg.Type {
+	case wsSubscribe:
+		c.subscribe(msg.Classroom)
+	case wsUnsubscribe:
+		c.mu.Lock()
+		sub := c.classrooms[msg.Classroom]
+		delete(c.classrooms, msg.Classroom)
+		c.mu.Unlock()
+
+		if sub != nil {
+			sub.Close()
+		}
+		c.queue(wsOutgoing{Type: wsUnsubscribed, Classroom: msg.Classroom})
+	case wsView:
+		c.view(msg.Task)
+	case wsLeave:
+		c.leave(msg.Task)
+	case wsTyping:
+		c.typing(msg.Task)
+	default:
+		c.queue(wsOutgoing{Type: wsError, Error: "unknown message type " + msg.Type})
+	}
+}
+
+// subscribe starts forwarding the events of a classroom, the same ones as on its event stream.
+func (c *wsClient) subscribe(classId int) {
+	c.mu.Lock()
+	_, subscribed := c.classrooms[classId]
+	count := len(c.classrooms)
+	c.mu.Unlock()
+
+	switch {
+	case subscribed:
+		c.queue(wsOutgoing{Type: wsSubscribed, Classroom: classId})
+		return
+	case count >= wsMaxClassrooms:
+		c.queue(wsOutgoing{Type: wsError, Classroom: classId, Error: "too many subscriptions"})
+		return
+	}
+
+	if _, err := c.app.models.Classrooms.Get(classId); err != nil {
+		c.queue(wsOutgoing{Type: wsError, Classroom: classId, Error: "classroom not found"})
+		return
+	}
+
+	sub, err := c.app.broker.Subscribe(classTopic(classId), 0)
+	if err != nil {
+		c.close(websocket.CloseInternalServerErr, "")
+		return
+	}
+
+	c.mu.Lock()
+	c.classrooms[classId] = sub
+	c.mu.Unlock()
+
+	go c.forward(sub, func(event broker.Event) wsOutgoing {
+		return wsOutgoing{Type: wsEvent, Classroom: classId, Event: &event}
+	})
+
+	c.queue(wsOutgoing{Type: wsSubscribed, Classroom: classId})
+}
+
+// view marks the user as viewing a task, which sends the new list of viewers to everyone
+// viewing it, and starts forwarding its presence and typing messages.
+func (c *wsClient) view(taskId int) {
+	c.mu.Lock()
+	_, viewing := c.viewing[taskId]
+	count := len(c.viewing)
+	c.mu.Unlock()
+
+	switch {
+	case viewing:
+		return
+	case count >= wsMaxViewing:
+		c.queue(wsOutgoing{Type: wsError, Task: taskId, Error: "viewing too many tasks"})
+		return
+	}
+
+	if _, err := c.app.models.Tasks.Get(taskId); err != nil {
+		c.queue(wsOutgoing{Type: wsError, Task: taskId, Error: "task not found"})
+		return
+	}
+
+	sub, err := c.app.broker.Subscribe(taskTopic(taskId), 0)
+	if err != nil {
+		c.close(websocket.CloseInternalServerErr, "")
+		return
+	}
+
+	c.mu.Lock()
+	c.viewing[taskId] = sub
+	c.mu.Unlock()
+
+	go c.forward(sub, func(event broker.Event) wsOutgoing {
+		return wsOutgoing{Type: event.Type, Task: taskId, Data: event.Data}
+	})
+
+	c.publishPresence(taskId, c.app.ws.view(taskId, c.user))
+}
+
+func (c *wsClient) leave(taskId int) {
+	c.mu.Lock()
+	sub, viewing := c.viewing[taskId]
+	delete(c.viewing, taskId)
+	c.mu.Unlock()
+
+	if !viewing {
+		return
+	}
+
+	sub.Close()
+	c.publishPresence(taskId, c.app.ws.leave(taskId, c.user))
+}
+
+// typing tells the other viewers of a task that the user is typing in its comment thread.
+func (c *wsClient) typing(taskId int) {
+	c.mu.Lock()
+	_, viewing := c.viewing[taskId]
+	c.mu.Unlock()
+
+	if !viewing {
+		c.queue(wsOutgoing{Type: wsError, Task: taskId, Error: "must view the task first"})
+		return
+	}
+
+	if time.Since(c.lastTyping[taskId]) < wsTypingInterval {
+		return
+	}
+	c.lastTyping[taskId] = time.Now()
+
+	err := c.app.broker.Publish(taskTopic(taskId), wsTyping, c.user)
+	if err != nil {
+		log.Printf("publish typing for task %d: %s", taskId, err)
+	}
+}
+
+func (c *wsClient) publishPresence(taskId int, users []wsUser) {
+	err := c.app.broker.Publish(taskTopic(taskId), wsPresence, users)
+	if err != nil {
+		log.Printf("publish presence for task %d: %s", taskId, err)
+	}
+}
+
+// forward queues the events of a subscription until it ends. If the client still holds the
+// subscription at that point, it was ended by the broker, which means events were lost, so the
+// connection is closed for the client to reconnect and reload.
+func (c *wsClient) forward(sub *broker.Subscription, message func(broker.Event) wsOutgoing) {
+	for event := range sub.Events {
+		c.queue(message(event))
+	}
+
+	c.mu.Lock()
+	lost := false
+	for _, subs := range []map[int]*broker.Subscription{c.classrooms, c.viewing} {
+		for _, s := range subs {
+			lost = lost || s == sub
+		}
+	}
+	c.mu.Unlock()
+
+	if lost {
+		c.close(websocket.CloseTryAgainLater, "event stream ended, reconnect")
+	}
+}
+
+// queue hands a message to the write loop. A client whose buffer is full is disconnected.
+func (c *wsClient) queue(msg wsOutgoing) {
+	select {
+	case <-c.done:
+	case c.send <- msg:
+	default:
+		c.close(websocket.CloseTryAgainLater, "client too slow")
+	}
+}
+
+func (c *wsClient) writeLoop() {
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case msg := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := c.conn.WriteJSON(msg); err != nil {
+				c.close(websocket.CloseNormalClosure, "")
+				return
+			}
+		case <-ping.C:
+			err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait))
+			if err != nil {
+				c.close(websocket.CloseNormalClosure, "")
+				return
+			}
+		}
+	}
+}
+
+// close sends a close message with the given code and reason and closes the connection, which
+// also ends the read loop. Only the first call has an effect.
+func (c *wsClient) close(code int, reason string) {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(wsWriteWait))
+		c.conn.Close()
+	})
+}
+
+// cleanup ends all subscriptions and presence of the connection once it is closed.
+func (c *wsClient) cleanup() {
+	c.mu.Lock()
+	classrooms, viewing := c.classrooms, c.viewing
+	c.classrooms, c.viewing = map[int]*broker.Subscription{}, map[int]*broker.Subscription{}
+	c.mu.Unlock()
+
+	for _, sub := range classrooms {
+		sub.Close()
+	}
+	for taskId, sub := range viewing {
+		sub.Close()
+		c.publishPresence(taskId, c.app.ws.leave(taskId, c.user))
+	}
+}
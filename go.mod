@@ -3,16 +3,17 @@ module FinalProject
 go 1.22rc2
 
 require (
+	github.com/evanphx/json-patch/v5 v5.9.11
 	github.com/golang-migrate/migrate/v4 v4.17.1
 	github.com/gorilla/mux v1.8.1
+	github.com/gorilla/websocket v1.5.3
 	github.com/lib/pq v1.10.9
+	github.com/peterbourgon/ff/v3 v3.4.0
 	golang.org/x/crypto v0.22.0
 )
 
 require (
 	github.com/hashicorp/errwrap v1.1.0 // indirect
 	github.com/hashicorp/go-multierror v1.1.1 // indirect
-	github.com/peterbourgon/ff/v3 v3.4.0 // indirect
 	go.uber.org/atomic v1.7.0 // indirect
-
 )
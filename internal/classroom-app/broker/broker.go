@@ -0,0 +1,219 @@
+// Package broker fans out real-time events to the clients that are subscribed to a topic, such
+// as the tasks of one classroom.
+package broker
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrClosed is returned by Subscribe once the broker has been closed.
+var ErrClosed = errors.New("broker closed")
+
+// Event is a single message published on a topic. Ids increase monotonically across all topics
+// of a broker, so a client can resume a topic from the last id it has seen.
+type Event struct {
+	Id   uint64          `json:"id"`
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// Broker publishes events and delivers them to subscribers. The in-process Memory broker only
+// reaches subscribers of the same instance; a broker backed by Postgres LISTEN/NOTIFY can
+// implement the same interface to fan out across instances.
+type Broker interface {
+	// Publish sends an event of the given type on topic. data is encoded as JSON.
+	Publish(topic, eventType string, data any) error
+
+	// Subscribe starts receiving the events of topic. When lastId is not 0 the events published
+	// after it are replayed first, see Subscription.
+	Subscribe(topic string, lastId uint64) (*Subscription, error)
+
+	// Close ends all subscriptions. It is called when the server shuts down.
+	Close()
+}
+
+// Subscription receives the events of one topic.
+type Subscription struct {
+	// Missed holds the events published since the lastId passed to Subscribe.
+	Missed []Event
+
+	// Gap is true if the events since lastId are no longer known, so the subscriber has to
+	// reload the current state instead of relying on Missed.
+	Gap bool
+
+	// Events receives new events. It is closed when the subscription ends, either through
+	// Close, because the broker was closed, or because the subscriber fell too far behind.
+	Events <-chan Event
+
+	close func()
+}
+
+// Close ends the subscription. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.close()
+}
+
+// Memory is an in-process Broker. It keeps the last events of every topic so that clients can
+// resume after a short disconnect.
+type Memory struct {
+	mu      sync.Mutex
+	startId uint64
+	lastId  uint64
+	topics  map[string]*topic
+	closed  bool
+
+	history int
+	buffer  int
+}
+
+type topic struct {
+	// events are the last events of the topic, oldest first.
+	events []Event
+	// dropped is the id of the newest event that no longer fits in the history.
+	dropped     uint64
+	subscribers map[*subscriber]struct{}
+}
+
+type subscriber struct {
+	ch     chan Event
+	closed bool
+}
+
+// NewMemory returns a broker that keeps the last history events of every topic and buffers up
+// to buffer events for each subscriber. A subscriber that doesn't keep up is dropped rather
+// than slowing down publishers; it can resume with the id of the last event it received.
+func NewMemory(history, buffer int) *Memory {
+	// Start from the current time so that ids keep increasing across restarts, and a client
+	// resuming with an id from before a restart is detected as a gap.
+	start := uint64(time.Now().UnixMicro())
+
+	return &Memory{
+		startId: start,
+		lastId:  start,
+		topics:  make(map[string]*topic),
+		history: history,
+		buffer:  buffer,
+	}
+}
+
+func (m *Memory) Publish(topicName, eventType string, data any) error {
+	js, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return ErrClosed
+	}
+
+	m.lastId++
+	event := Event{Id: m.lastId, Type: eventType, Data: js}
+
+	t := m.topic(topicName)
+	t.events = append(t.events, event)
+	if len(t.events) > m.history {
+		n := len(t.events) - m.history
+		t.dropped = t.events[n-1].Id
+		t.events = append([]Event(nil), t.events[n:]...)
+	}
+
+	for s := range t.subscribers {
+		select {
+		case s.ch <- event:
+		default:
+			m.unsubscribe(t, topicName, s)
+		}
+	}
+
+	return nil
+}
+
+func (m *Memory) Subscribe(topicName string, lastId uint64) (*Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return nil, ErrClosed
+	}
+
+	t := m.topic(topicName)
+	s := &subscriber{ch: make(chan Event, m.buffer)}
+	t.subscribers[s] = struct{}{}
+
+	sub := &Subscription{
+		Events: s.ch,
+		close: func() {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			m.unsubscribe(t, topicName, s)
+		},
+	}
+
+	if lastId != 0 {
+		if lastId < m.startId || lastId > m.lastId {
+			sub.Gap = true
+		} else {
+			sub.Missed, sub.Gap = t.since(lastId)
+		}
+	}
+
+	return sub, nil
+}
+
+func (m *Memory) Close() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.closed = true
+	for name, t := range m.topics {
+		for s := range t.subscribers {
+			m.unsubscribe(t, name, s)
+		}
+	}
+}
+
+// topic returns the topic with the given name, creating it if needed. m.mu must be held.
+func (m *Memory) topic(name string) *topic {
+	t, ok := m.topics[name]
+	if !ok {
+		t = &topic{subscribers: make(map[*subscriber]struct{})}
+		m.topics[name] = t
+	}
+	return t
+}
+
+// unsubscribe removes s from t and closes its channel. m.mu must be held.
+func (m *Memory) unsubscribe(t *topic, name string, s *subscriber) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.ch)
+	delete(t.subscribers, s)
+
+	// Topics without subscribers are kept as long as they have history to replay.
+	if len(t.subscribers) == 0 && len(t.events) == 0 {
+		delete(m.topics, name)
+	}
+}
+
+// since returns the events of t after lastId. gap is true if some of them have already been
+// dropped from the history.
+func (t *topic) since(lastId uint64) ([]Event, bool) {
+	if lastId < t.dropped {
+		return nil, true
+	}
+
+	for i, event := range t.events {
+		if event.Id > lastId {
+			return append([]Event(nil), t.events[i:]...), false
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS task_search_idx;
+DROP INDEX IF EXISTS classroom_search_idx;
+
+ALTER TABLE task DROP COLUMN IF EXISTS search_vector;
+ALTER TABLE classroom DROP COLUMN IF EXISTS search_vector;
@@ -0,0 +1,16 @@
+ALTER TABLE classroom
+    ADD COLUMN IF NOT EXISTS search_vector tsvector
+        GENERATED ALWAYS AS (
+            setweight(to_tsvector('simple', coalesce(name, '')), 'A') ||
+            setweight(to_tsvector('simple', coalesce(description, '')), 'B')
+            ) STORED;
+
+ALTER TABLE task
+    ADD COLUMN IF NOT EXISTS search_vector tsvector
+        GENERATED ALWAYS AS (
+            setweight(to_tsvector('simple', coalesce(header, '')), 'A') ||
+            setweight(to_tsvector('simple', coalesce(description, '')), 'B')
+            ) STORED;
+
+CREATE INDEX IF NOT EXISTS classroom_search_idx ON classroom USING GIN (search_vector);
+CREATE INDEX IF NOT EXISTS task_search_idx ON task USING GIN (search_vector);
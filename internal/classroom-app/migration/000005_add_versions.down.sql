@@ -0,0 +1,2 @@
+ALTER TABLE task DROP COLUMN IF EXISTS version;
+ALTER TABLE classroom DROP COLUMN IF EXISTS version;
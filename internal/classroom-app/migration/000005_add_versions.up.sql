@@ -0,0 +1,5 @@
+ALTER TABLE classroom
+    ADD COLUMN IF NOT EXISTS version integer NOT NULL DEFAULT 1;
+
+ALTER TABLE task
+    ADD COLUMN IF NOT EXISTS version integer NOT NULL DEFAULT 1;
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS update_classroom_timestamp ON classroom;
+
+ALTER TABLE classroom DROP COLUMN IF EXISTS updated_at;
@@ -0,0 +1,12 @@
+ALTER TABLE classroom
+    ADD COLUMN IF NOT EXISTS updated_at timestamp(0) with time zone DEFAULT now();
+
+UPDATE classroom
+SET updated_at = created_at;
+
+CREATE TRIGGER update_classroom_timestamp
+    BEFORE UPDATE
+    ON classroom
+    FOR EACH ROW
+EXECUTE PROCEDURE
+    update_timestamp();
@@ -0,0 +1,10 @@
+DROP INDEX IF EXISTS task_deleted_idx;
+DROP INDEX IF EXISTS classroom_deleted_idx;
+
+ALTER TABLE task
+    DROP COLUMN IF EXISTS deleted_by,
+    DROP COLUMN IF EXISTS deleted_at;
+
+ALTER TABLE classroom
+    DROP COLUMN IF EXISTS deleted_by,
+    DROP COLUMN IF EXISTS deleted_at;
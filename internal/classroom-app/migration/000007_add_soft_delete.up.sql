@@ -0,0 +1,10 @@
+ALTER TABLE classroom
+    ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) with time zone,
+    ADD COLUMN IF NOT EXISTS deleted_by int REFERENCES users ON DELETE SET NULL;
+
+ALTER TABLE task
+    ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) with time zone,
+    ADD COLUMN IF NOT EXISTS deleted_by int REFERENCES users ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS classroom_deleted_idx ON classroom (deleted_by, deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS task_deleted_idx ON task (deleted_by, deleted_at) WHERE deleted_at IS NOT NULL;
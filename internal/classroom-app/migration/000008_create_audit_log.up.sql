@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS audit_log
+(
+    id          bigserial PRIMARY KEY,
+    created_at  timestamp(0) with time zone NOT NULL DEFAULT now(),
+    actor_id    int,
+    ip          text                        NOT NULL DEFAULT '',
+    request_id  text                        NOT NULL DEFAULT '',
+    action      text                        NOT NULL,
+    entity_type text                        NOT NULL,
+    entity_id   int                         NOT NULL,
+    changes     jsonb                       NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_entity_idx ON audit_log (entity_type, entity_id);
+CREATE INDEX IF NOT EXISTS audit_log_actor_idx ON audit_log (actor_id);
+CREATE INDEX IF NOT EXISTS audit_log_created_at_idx ON audit_log (created_at);
+
+-- The audit log is append-only.
+CREATE OR REPLACE FUNCTION audit_log_immutable()
+    RETURNS TRIGGER AS
+$$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ language 'plpgsql';
+
+CREATE TRIGGER audit_log_no_update_or_delete
+    BEFORE UPDATE OR DELETE
+    ON audit_log
+    FOR EACH ROW
+EXECUTE PROCEDURE
+    audit_log_immutable();
+
+INSERT INTO permissions (code)
+VALUES ('audit:read');
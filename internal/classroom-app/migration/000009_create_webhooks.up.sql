@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS webhooks
+(
+    id         serial PRIMARY KEY,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+    created_by int REFERENCES users ON DELETE SET NULL,
+    url        text                        NOT NULL,
+    secret     text                        NOT NULL,
+    events     text[]                      NOT NULL,
+    active     bool                        NOT NULL DEFAULT true
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries
+(
+    id               bigserial PRIMARY KEY,
+    webhook_id       int                         NOT NULL REFERENCES webhooks ON DELETE CASCADE,
+    created_at       timestamp(0) with time zone NOT NULL DEFAULT now(),
+    event            text                        NOT NULL,
+    payload          jsonb                       NOT NULL,
+    status           text                        NOT NULL DEFAULT 'pending',
+    attempts         int                         NOT NULL DEFAULT 0,
+    next_attempt_at  timestamp(0) with time zone NOT NULL DEFAULT now(),
+    last_status_code int,
+    last_error       text                        NOT NULL DEFAULT '',
+    delivered_at     timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_due_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_deliveries_webhook_idx ON webhook_deliveries (webhook_id, id);
+
+INSERT INTO permissions (code)
+VALUES ('webhook:write');
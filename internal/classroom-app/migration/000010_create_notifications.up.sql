@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS notifications
+(
+    id          bigserial PRIMARY KEY,
+    user_id     int                         NOT NULL REFERENCES users ON DELETE CASCADE,
+    created_at  timestamp(0) with time zone NOT NULL DEFAULT now(),
+    event       text                        NOT NULL,
+    entity_type text                        NOT NULL,
+    entity_id   int                         NOT NULL,
+    actor_id    int REFERENCES users ON DELETE SET NULL,
+    title       text                        NOT NULL,
+    read_at     timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS notifications_user_idx ON notifications (user_id, id DESC);
+CREATE INDEX IF NOT EXISTS notifications_unread_idx ON notifications (user_id) WHERE read_at IS NULL;
+
+-- A row mutes one event type for one user. Events without a row are delivered.
+CREATE TABLE IF NOT EXISTS notification_mutes
+(
+    user_id int  NOT NULL REFERENCES users ON DELETE CASCADE,
+    event   text NOT NULL,
+    PRIMARY KEY (user_id, event)
+);
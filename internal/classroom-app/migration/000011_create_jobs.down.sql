@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE code = 'job:admin';
+
+DROP TABLE IF EXISTS jobs;
@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS jobs
+(
+    id           bigserial PRIMARY KEY,
+    created_at   timestamp(0) with time zone NOT NULL DEFAULT now(),
+    kind         text                        NOT NULL,
+    payload      jsonb                       NOT NULL DEFAULT '{}',
+    -- At most one job with the same unique_key can be pending or running at a time.
+    unique_key   text,
+    status       text                        NOT NULL DEFAULT 'pending',
+    attempts     int                         NOT NULL DEFAULT 0,
+    max_attempts int                         NOT NULL DEFAULT 5,
+    run_at       timestamp(0) with time zone NOT NULL DEFAULT now(),
+    locked_at    timestamp(0) with time zone,
+    last_error   text                        NOT NULL DEFAULT '',
+    finished_at  timestamp(0) with time zone
+);
+
+CREATE INDEX IF NOT EXISTS jobs_due_idx ON jobs (run_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS jobs_running_idx ON jobs (locked_at) WHERE status = 'running';
+CREATE UNIQUE INDEX IF NOT EXISTS jobs_unique_key_idx ON jobs (unique_key) WHERE status IN ('pending', 'running');
+
+INSERT INTO permissions (code)
+VALUES ('job:admin');
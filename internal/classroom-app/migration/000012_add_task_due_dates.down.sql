@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS task_reminders;
+
+DROP INDEX IF EXISTS task_due_at_idx;
+
+ALTER TABLE task
+    DROP COLUMN IF EXISTS due_at;
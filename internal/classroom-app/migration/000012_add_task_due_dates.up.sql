@@ -0,0 +1,15 @@
+ALTER TABLE task
+    ADD COLUMN IF NOT EXISTS due_at timestamp(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS task_due_at_idx ON task (due_at) WHERE due_at IS NOT NULL AND deleted_at IS NULL;
+
+-- One row per reminder sent, so that no reminder is sent twice. due_at is part of the key so
+-- that moving the due date schedules the reminders again.
+CREATE TABLE IF NOT EXISTS task_reminders
+(
+    task_id        int                         NOT NULL REFERENCES task ON DELETE CASCADE,
+    offset_seconds int                         NOT NULL,
+    due_at         timestamp(0) with time zone NOT NULL,
+    sent_at        timestamp(0) with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (task_id, offset_seconds, due_at)
+);
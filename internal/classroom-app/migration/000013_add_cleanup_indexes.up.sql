@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS tokens_expiry_idx ON tokens (expiry);
+CREATE INDEX IF NOT EXISTS users_unactivated_idx ON users (created_at) WHERE NOT activated;
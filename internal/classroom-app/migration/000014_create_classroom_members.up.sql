@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS classroom_members
+(
+    class_id   int                         NOT NULL REFERENCES classroom ON DELETE CASCADE,
+    user_id    int                         NOT NULL REFERENCES users ON DELETE CASCADE,
+    role       text                        NOT NULL CHECK (role IN ('student', 'teacher')),
+    created_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (class_id, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS classroom_members_user_idx ON classroom_members (user_id);
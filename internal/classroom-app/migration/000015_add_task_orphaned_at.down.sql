@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS classroom_task_task_idx;
+
+ALTER TABLE task DROP COLUMN IF EXISTS orphaned_at;
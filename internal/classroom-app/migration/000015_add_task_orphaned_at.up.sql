@@ -0,0 +1,6 @@
+ALTER TABLE task ADD COLUMN IF NOT EXISTS orphaned_at timestamp(0) with time zone;
+
+UPDATE task SET orphaned_at = now()
+WHERE NOT EXISTS (SELECT 1 FROM classroom_task WHERE task_id = task.id);
+
+CREATE INDEX IF NOT EXISTS classroom_task_task_idx ON classroom_task (task_id);
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS task_templates
+(
+    id          bigserial PRIMARY KEY,
+    owner_id    int                         NOT NULL REFERENCES users ON DELETE CASCADE,
+    shared      bool                        NOT NULL DEFAULT false,
+    header      text                        NOT NULL,
+    description text                        NOT NULL,
+    due_at      timestamp(0) with time zone,
+    created_at  timestamp(0) with time zone NOT NULL DEFAULT now(),
+    updated_at  timestamp(0) with time zone NOT NULL DEFAULT now(),
+    version     int                         NOT NULL DEFAULT 1
+);
+
+CREATE INDEX IF NOT EXISTS task_templates_owner_idx ON task_templates (owner_id);
+CREATE INDEX IF NOT EXISTS task_templates_shared_idx ON task_templates (id) WHERE shared;
@@ -0,0 +1,5 @@
+ALTER TABLE classroom
+    DROP COLUMN IF EXISTS archived_at,
+    DROP COLUMN IF EXISTS term_id;
+
+DROP TABLE IF EXISTS terms;
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS terms
+(
+    id         serial PRIMARY KEY,
+    name       text                        NOT NULL UNIQUE,
+    starts_on  date                        NOT NULL,
+    ends_on    date                        NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+    version    int                         NOT NULL DEFAULT 1,
+    CHECK (ends_on >= starts_on)
+);
+
+ALTER TABLE classroom
+    ADD COLUMN IF NOT EXISTS term_id     int REFERENCES terms ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS archived_at timestamp(0) with time zone;
+
+CREATE INDEX IF NOT EXISTS classroom_term_idx ON classroom (term_id);
@@ -0,0 +1,5 @@
+ALTER TABLE jobs
+    DROP COLUMN IF EXISTS result,
+    DROP COLUMN IF EXISTS total,
+    DROP COLUMN IF EXISTS progress,
+    DROP COLUMN IF EXISTS user_id;
@@ -0,0 +1,5 @@
+ALTER TABLE jobs
+    ADD COLUMN IF NOT EXISTS user_id  int REFERENCES users ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS progress int NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS total    int NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS result   jsonb;
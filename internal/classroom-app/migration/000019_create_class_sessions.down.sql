@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS class_sessions;
+DROP TABLE IF EXISTS rooms;
+DROP TYPE IF EXISTS timerange;
@@ -0,0 +1,42 @@
+CREATE EXTENSION IF NOT EXISTS btree_gist;
+
+-- timerange is a range of times of day, for the times sessions take a room.
+CREATE TYPE timerange AS RANGE (subtype = time);
+
+CREATE TABLE IF NOT EXISTS rooms
+(
+    id         serial PRIMARY KEY,
+    name       text                        NOT NULL UNIQUE,
+    capacity   int                         NOT NULL DEFAULT 0 CHECK (capacity >= 0),
+    created_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+    version    int                         NOT NULL DEFAULT 1
+);
+
+-- A class session takes place every week on weekday (0 is Sunday) from starts_at to ends_at,
+-- between starts_on and ends_on, except on the dates in exceptions.
+CREATE TABLE IF NOT EXISTS class_sessions
+(
+    id         serial PRIMARY KEY,
+    class_id   int                         NOT NULL REFERENCES classroom ON DELETE CASCADE,
+    room_id    int REFERENCES rooms ON DELETE SET NULL,
+    weekday    smallint                    NOT NULL CHECK (weekday BETWEEN 0 AND 6),
+    starts_at  time                        NOT NULL,
+    ends_at    time                        NOT NULL,
+    starts_on  date                        NOT NULL,
+    ends_on    date                        NOT NULL,
+    exceptions date[]                      NOT NULL DEFAULT '{}',
+    created_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+    version    int                         NOT NULL DEFAULT 1,
+    CHECK (ends_at > starts_at),
+    CHECK (ends_on >= starts_on),
+    -- A room can't be booked by two sessions on the same weekday at overlapping times while
+    -- their date ranges overlap. Sessions that meet back to back don't overlap.
+    CONSTRAINT class_sessions_room_overlap EXCLUDE USING gist (
+        room_id WITH =,
+        weekday WITH =,
+        daterange(starts_on, ends_on, '[]') WITH &&,
+        timerange(starts_at, ends_at) WITH &&
+    )
+);
+
+CREATE INDEX IF NOT EXISTS class_sessions_class_idx ON class_sessions (class_id);
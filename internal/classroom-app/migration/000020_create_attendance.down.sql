@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS attendance_codes;
+DROP TABLE IF EXISTS attendance;
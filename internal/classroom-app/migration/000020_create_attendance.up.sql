@@ -0,0 +1,24 @@
+-- Attendance of a student at one occurrence of a class session, the session on on_date.
+CREATE TABLE IF NOT EXISTS attendance
+(
+    session_id  int                         NOT NULL REFERENCES class_sessions ON DELETE CASCADE,
+    on_date     date                        NOT NULL,
+    user_id     int                         NOT NULL REFERENCES users ON DELETE CASCADE,
+    status      text                        NOT NULL CHECK (status IN ('present', 'absent', 'late', 'excused')),
+    -- checked_in is set when the student checked in with a code instead of being recorded.
+    checked_in  boolean                     NOT NULL DEFAULT false,
+    recorded_by int REFERENCES users ON DELETE SET NULL,
+    recorded_at timestamp(0) with time zone NOT NULL DEFAULT now(),
+    PRIMARY KEY (session_id, on_date, user_id)
+);
+
+CREATE INDEX IF NOT EXISTS attendance_user_idx ON attendance (user_id);
+
+-- A check-in code is a short-lived token of the teacher who created it, for one occurrence of a
+-- session. It goes away with its token when that expires.
+CREATE TABLE IF NOT EXISTS attendance_codes
+(
+    token_hash bytea PRIMARY KEY REFERENCES tokens ON DELETE CASCADE,
+    session_id int  NOT NULL REFERENCES class_sessions ON DELETE CASCADE,
+    on_date    date NOT NULL
+);
@@ -0,0 +1,49 @@
+-- A task with a quiz is a quiz task. Its answer keys live in the key_ columns of its questions.
+CREATE TABLE IF NOT EXISTS quizzes
+(
+    task_id            int PRIMARY KEY REFERENCES task ON DELETE CASCADE,
+    time_limit_minutes int CHECK (time_limit_minutes > 0),
+    max_attempts       int CHECK (max_attempts > 0),
+    shuffle_questions  boolean                     NOT NULL DEFAULT false,
+    shuffle_options    boolean                     NOT NULL DEFAULT false,
+    closes_at          timestamp(0) with time zone,
+    created_at         timestamp(0) with time zone NOT NULL DEFAULT now(),
+    updated_at         timestamp(0) with time zone NOT NULL DEFAULT now(),
+    version            int                         NOT NULL DEFAULT 1
+);
+
+CREATE TABLE IF NOT EXISTS quiz_questions
+(
+    id                 serial PRIMARY KEY,
+    task_id            int     NOT NULL REFERENCES quizzes ON DELETE CASCADE,
+    position           int     NOT NULL,
+    kind               text    NOT NULL CHECK (kind IN ('single', 'multi', 'numeric', 'text')),
+    prompt             text    NOT NULL,
+    points             int     NOT NULL CHECK (points > 0),
+    options            text[]  NOT NULL DEFAULT '{}',
+    key_options        int[]   NOT NULL DEFAULT '{}',
+    key_number         double precision,
+    key_tolerance      double precision NOT NULL DEFAULT 0,
+    key_texts          text[]  NOT NULL DEFAULT '{}',
+    key_match          text    NOT NULL DEFAULT 'exact' CHECK (key_match IN ('exact', 'regex')),
+    key_case_sensitive boolean NOT NULL DEFAULT false,
+    UNIQUE (task_id, position)
+);
+
+-- seed makes the order of the questions and options of an attempt the same every time it is
+-- shown, and different for every attempt.
+CREATE TABLE IF NOT EXISTS quiz_attempts
+(
+    id           serial PRIMARY KEY,
+    task_id      int                         NOT NULL REFERENCES quizzes ON DELETE CASCADE,
+    user_id      int                         NOT NULL REFERENCES users ON DELETE CASCADE,
+    number       int                         NOT NULL,
+    seed         bigint                      NOT NULL,
+    started_at   timestamp(0) with time zone NOT NULL DEFAULT now(),
+    deadline_at  timestamp(0) with time zone,
+    submitted_at timestamp(0) with time zone,
+    answers      jsonb                       NOT NULL DEFAULT '{}',
+    score        int,
+    max_score    int                         NOT NULL,
+    UNIQUE (task_id, user_id, number)
+);
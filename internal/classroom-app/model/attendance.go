@@ -0,0 +1,455 @@
+package model
+
+import (
+	"FinalProject/internal/classroom-app/validator"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Attendance statuses.
+const (
+	AttendancePresent = "present"
+	AttendanceAbsent  = "absent"
+	AttendanceLate    = "late"
+	AttendanceExcused = "excused"
+)
+
+// ErrNotStudent is returned when a user checks in to a session of a classroom they aren't a
+// student of.
+var ErrNotStudent = errors.New("not a student of the classroom")
+
+// Attendance is whether a student attended one occurrence of a class session. Status is nil
+// while nothing has been recorded.
+type Attendance struct {
+	SessionId  int        `json:"sessionId"`
+	Date       string     `json:"date"`
+	UserID     int        `json:"userId"`
+	FirstName  string     `json:"firstName"`
+	LastName   string     `json:"lastName"`
+	Email      string     `json:"email"`
+	Status     *string    `json:"status"`
+	CheckedIn  bool       `json:"checkedIn"`
+	RecordedAt *time.Time `json:"recordedAt"`
+}
+
+// AttendanceRecord is the status a teacher records for a student.
+type AttendanceRecord struct {
+	UserID int    `json:"userId"`
+	Status string `json:"status"`
+}
+
+// AttendanceSummary counts the recorded attendance of a student over all sessions of a
+// classroom. Rate is the percentage of the sessions the student wasn't excused from that they
+// were present or late at, and nil if there are none.
+type AttendanceSummary struct {
+	UserID    int      `json:"userId"`
+	FirstName string   `json:"firstName"`
+	LastName  string   `json:"lastName"`
+	Email     string   `json:"email"`
+	Present   int      `json:"present"`
+	Absent    int      `json:"absent"`
+	Late      int      `json:"late"`
+	Excused   int      `json:"excused"`
+	Rate      *float64 `json:"rate"`
+}
+
+// CheckInCode is a code students check in to one occurrence of a session with.
+type CheckInCode struct {
+	Code      string    `json:"code"`
+	SessionId int       `json:"sessionId"`
+	Date      string    `json:"date"`
+	Expiry    time.Time `json:"expiry"`
+}
+
+type AttendanceModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+}
+
+// GetForOccurrence returns the attendance of every student of the session's classroom on the
+// date, ordered by name.
+func (m AttendanceModel) GetForOccurrence(session *ClassSession, date string) ([]*Attendance, error) {
+	query := `
+		SELECT u.id, u.first_name, u.last_name, u.email, a.status, COALESCE(a.checked_in, false), a.recorded_at
+		FROM classroom_members cm
+			INNER JOIN users u ON u.id = cm.user_id
+			LEFT JOIN attendance a ON a.user_id = cm.user_id AND a.session_id = $2 AND a.on_date = $3
+		WHERE cm.class_id = $1 AND cm.role = 'student'
+		ORDER BY u.last_name, u.first_name, u.id
+		`
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, session.ClassId, session.Id, date)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	attendance := []*Attendance{}
+	for rows.Next() {
+		entry := Attendance{SessionId: session.Id, Date: date}
+		err := rows.Scan(
+			&entry.UserID,
+			&entry.FirstName,
+			&entry.LastName,
+			&entry.Email,
+			&entry.Status,
+			&entry.CheckedIn,
+			&entry.RecordedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		attendance = append(attendance, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return attendance, nil
+}
+
+// Record records the attendance of students at the session on the date, replacing what was
+// recorded or checked in before. It returns ErrArchived if the classroom is archived and
+// FieldErrors if one of the users isn't a student of it.
+func (m AttendanceModel) Record(session *ClassSession, date string, records []AttendanceRecord, actor Actor) error {
+	query := `
+		INSERT INTO attendance (session_id, on_date, user_id, status, recorded_by)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (session_id, on_date, user_id) DO UPDATE
+		SET status = EXCLUDED.status, checked_in = false, recorded_by = EXCLUDED.recorded_by, recorded_at = now()
+		`
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = lockWritableClassroom(ctx, tx, session.ClassId); err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		student, err := isStudent(ctx, tx, session.ClassId, record.UserID)
+		if err != nil {
+			return err
+		}
+		if !student {
+			return FieldErrors{"records": fmt.Sprintf("user %d is not a student of the classroom", record.UserID)}
+		}
+
+		var before any
+		var status string
+		err = tx.QueryRowContext(ctx, `
+			SELECT status FROM attendance
+			WHERE session_id = $1 AND on_date = $2 AND user_id = $3
+			FOR UPDATE
+			`, session.Id, date, record.UserID).Scan(&status)
+		switch {
+		case err == nil:
+			before = map[string]any{"date": date, "user_id": record.UserID, "status": status}
+		case !errors.Is(err, sql.ErrNoRows):
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, query, session.Id, date, record.UserID, record.Status, actorUserID(actor))
+		if err != nil {
+			return err
+		}
+
+		after := map[string]any{"date": date, "user_id": record.UserID, "status": record.Status}
+		if err := insertAuditEntry(ctx, tx, actor, AuditUpdate, EntityAttendance, session.Id, before, after); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// NewCheckInCode creates a code students can check in to the session on the date with until it
+// expires after ttl. The code is a token of the user of actor. It returns ErrArchived if the
+// classroom is archived.
+func (m AttendanceModel) NewCheckInCode(session *ClassSession, date string, ttl time.Duration, actor Actor) (*CheckInCode, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if err = lockWritableClassroom(ctx, tx, session.ClassId); err != nil {
+		return nil, err
+	}
+
+	token, err := generateToken(actor.UserID, ttl, ScopeCheckIn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = insertToken(ctx, tx, token, actor); err != nil {
+		return nil, err
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO attendance_codes (token_hash, session_id, on_date) VALUES ($1, $2, $3)`, token.Hash, session.Id, date)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &CheckInCode{Code: token.Plaintext, SessionId: session.Id, Date: date, Expiry: token.Expiry}, nil
+}
+
+// CheckIn records the user as present at the session occurrence of the code. If attendance was
+// already recorded for them, it is kept as it is. It returns FieldErrors if the code is invalid
+// or expired, ErrNotStudent if the user isn't a student of the classroom and ErrArchived if the
+// classroom is archived.
+func (m AttendanceModel) CheckIn(code string, userID int, actor Actor) (*Attendance, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	hash := sha256.Sum256([]byte(code))
+
+	attendance := Attendance{UserID: userID}
+	var classId int
+	err = tx.QueryRowContext(ctx, `
+		SELECT ac.session_id, ac.on_date::text, s.class_id
+		FROM attendance_codes ac
+			INNER JOIN tokens t ON t.hash = ac.token_hash
+			INNER JOIN class_sessions s ON s.id = ac.session_id
+		WHERE ac.token_hash = $1 AND t.scope = $2 AND t.expiry > now()
+		`, hash[:], ScopeCheckIn).Scan(&attendance.SessionId, &attendance.Date, &classId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, FieldErrors{"code": "invalid or expired check-in code"}
+		}
+		return nil, err
+	}
+
+	if err = lockWritableClassroom(ctx, tx, classId); err != nil {
+		return nil, err
+	}
+
+	student, err := isStudent(ctx, tx, classId, userID)
+	if err != nil {
+		return nil, err
+	}
+	if !student {
+		return nil, ErrNotStudent
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		INSERT INTO attendance (session_id, on_date, user_id, status, checked_in, recorded_by)
+		VALUES ($1, $2, $3, 'present', true, $3)
+		ON CONFLICT (session_id, on_date, user_id) DO NOTHING
+		`, attendance.SessionId, attendance.Date, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return nil, err
+	}
+	if inserted > 0 {
+		after := map[string]any{"date": attendance.Date, "user_id": userID, "status": AttendancePresent, "checked_in": true}
+		if err := insertAuditEntry(ctx, tx, actor, AuditCreate, EntityAttendance, attendance.SessionId, nil, after); err != nil {
+			return nil, err
+		}
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		SELECT u.first_name, u.last_name, u.email, a.status, a.checked_in, a.recorded_at
+		FROM attendance a
+			INNER JOIN users u ON u.id = a.user_id
+		WHERE a.session_id = $1 AND a.on_date = $2 AND a.user_id = $3
+		`, attendance.SessionId, attendance.Date, userID).Scan(
+		&attendance.FirstName,
+		&attendance.LastName,
+		&attendance.Email,
+		&attendance.Status,
+		&attendance.CheckedIn,
+		&attendance.RecordedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &attendance, nil
+}
+
+// Summary returns the attendance of every student of the classroom over all of its sessions,
+// ordered by name.
+func (m AttendanceModel) Summary(classId int) ([]*AttendanceSummary, error) {
+	query := `
+		SELECT u.id, u.first_name, u.last_name, u.email,
+			count(*) FILTER (WHERE a.status = 'present'),
+			count(*) FILTER (WHERE a.status = 'absent'),
+			count(*) FILTER (WHERE a.status = 'late'),
+			count(*) FILTER (WHERE a.status = 'excused')
+		FROM classroom_members cm
+			INNER JOIN users u ON u.id = cm.user_id
+			LEFT JOIN attendance a ON a.user_id = cm.user_id
+				AND a.session_id IN (SELECT id FROM class_sessions WHERE class_id = $1)
+		WHERE cm.class_id = $1 AND cm.role = 'student'
+		GROUP BY u.id
+		ORDER BY u.last_name, u.first_name, u.id
+		`
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, classId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	summaries := []*AttendanceSummary{}
+	for rows.Next() {
+		var summary AttendanceSummary
+		err := rows.Scan(
+			&summary.UserID,
+			&summary.FirstName,
+			&summary.LastName,
+			&summary.Email,
+			&summary.Present,
+			&summary.Absent,
+			&summary.Late,
+			&summary.Excused,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		if counted := summary.Present + summary.Late + summary.Absent; counted > 0 {
+			rate := float64(summary.Present+summary.Late) * 100 / float64(counted)
+			rate = float64(int(rate*10+0.5)) / 10
+			summary.Rate = &rate
+		}
+		summaries = append(summaries, &summary)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return summaries, nil
+}
+
+// GetAllOfClass returns every recorded attendance of the classroom's sessions, in the order the
+// sessions took place.
+func (m AttendanceModel) GetAllOfClass(classId int) ([]*Attendance, error) {
+	query := `
+		SELECT a.session_id, a.on_date::text, u.id, u.first_name, u.last_name, u.email, a.status,
+			a.checked_in, a.recorded_at
+		FROM attendance a
+			INNER JOIN class_sessions s ON s.id = a.session_id
+			INNER JOIN users u ON u.id = a.user_id
+		WHERE s.class_id = $1
+		ORDER BY a.on_date, s.starts_at, s.id, u.last_name, u.first_name, u.id
+		`
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, classId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	attendance := []*Attendance{}
+	for rows.Next() {
+		var entry Attendance
+		err := rows.Scan(
+			&entry.SessionId,
+			&entry.Date,
+			&entry.UserID,
+			&entry.FirstName,
+			&entry.LastName,
+			&entry.Email,
+			&entry.Status,
+			&entry.CheckedIn,
+			&entry.RecordedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		attendance = append(attendance, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return attendance, nil
+}
+
+// isStudent reports whether the user is a student of the classroom.
+func isStudent(ctx context.Context, tx *sql.Tx, classId, userID int) (bool, error) {
+	var student bool
+	err := tx.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM classroom_members WHERE class_id = $1 AND user_id = $2 AND role = 'student')
+		`, classId, userID).Scan(&student)
+	return student, err
+}
+
+// actorUserID is the user of actor, or nil for the system.
+func actorUserID(actor Actor) *int {
+	if actor.UserID == 0 {
+		return nil
+	}
+	return &actor.UserID
+}
+
+func ValidateAttendanceRecords(v *validator.Validator, records []AttendanceRecord) {
+	v.Check(len(records) > 0, "records", "must be provided")
+	v.Check(len(records) <= 1000, "records", "must not have more than 1000 records")
+
+	seen := make(map[int]bool, len(records))
+	for _, record := range records {
+		if !validator.In(record.Status, AttendancePresent, AttendanceAbsent, AttendanceLate, AttendanceExcused) {
+			v.AddError("records", "status must be present, absent, late or excused")
+			return
+		}
+		if record.UserID < 1 || seen[record.UserID] {
+			v.AddError("records", "must have one record per valid user id")
+			return
+		}
+		seen[record.UserID] = true
+	}
+}
@@ -0,0 +1,222 @@
+package model
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// Audit log actions.
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+	AuditPurge   = "purge"
+)
+
+// Audit log entity types.
+const (
+	EntityClassroom  = "classroom"
+	EntityTask       = "task"
+	EntityUser       = "user"
+	EntityPermission = "permission"
+	EntityToken      = "token"
+	EntityTemplate   = "task_template"
+	EntityTerm       = "term"
+	EntityRoom       = "room"
+	EntitySession    = "class_session"
+	// EntityQuiz entries are keyed by the task the quiz belongs to.
+	EntityQuiz = "quiz"
+	// EntityMember entries are keyed by the classroom, the user is part of the changes.
+	EntityMember = "classroom_member"
+	// EntityAttendance entries are keyed by the session, the date and user are part of the changes.
+	EntityAttendance = "attendance"
+)
+
+// Actor describes who made a change. The zero value is the system itself, e.g. a background
+// job or an unauthenticated request.
+type Actor struct {
+	UserID    int
+	IP        string
+	RequestID string
+}
+
+// Change holds the old and new value of a field that was changed.
+type Change struct {
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+type AuditEntry struct {
+	Id         int64             `json:"id"`
+	CreatedAt  time.Time         `json:"created_at"`
+	ActorID    *int              `json:"actor_id"`
+	IP         string            `json:"ip"`
+	RequestID  string            `json:"request_id"`
+	Action     string            `json:"action"`
+	EntityType string            `json:"entity_type"`
+	EntityID   int               `json:"entity_id"`
+	Changes    map[string]Change `json:"changes"`
+}
+
+// AuditFilters narrows down the audit log. Zero values don't filter.
+type AuditFilters struct {
+	ActorID    int
+	EntityType string
+	EntityID   int
+	From       time.Time
+	To         time.Time
+}
+
+type AuditModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+}
+
+// GetAll returns the entries of the audit log that match the filters, newest first.
+func (m AuditModel) GetAll(audit AuditFilters, filters Filters) ([]*AuditEntry, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), id, created_at, actor_id, ip, request_id, action, entity_type, entity_id, changes
+		FROM audit_log
+		WHERE (actor_id = $1 OR $1 = 0)
+			AND (entity_type = $2 OR $2 = '')
+			AND (entity_id = $3 OR $3 = 0)
+			AND ($4::timestamptz IS NULL OR created_at >= $4)
+			AND ($5::timestamptz IS NULL OR created_at < $5)
+		ORDER BY id DESC
+		LIMIT $6 OFFSET $7
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	from := sql.NullTime{Time: audit.From, Valid: !audit.From.IsZero()}
+	to := sql.NullTime{Time: audit.To, Valid: !audit.To.IsZero()}
+
+	args := []any{audit.ActorID, audit.EntityType, audit.EntityID, from, to, filters.limit(), filters.offset()}
+
+	rows, err := m.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	totalRecords := 0
+
+	entries := []*AuditEntry{}
+	for rows.Next() {
+		var entry AuditEntry
+		var changes []byte
+		err := rows.Scan(
+			&totalRecords,
+			&entry.Id,
+			&entry.CreatedAt,
+			&entry.ActorID,
+			&entry.IP,
+			&entry.RequestID,
+			&entry.Action,
+			&entry.EntityType,
+			&entry.EntityID,
+			&changes,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		if err := json.Unmarshal(changes, &entry.Changes); err != nil {
+			return nil, Metadata{}, err
+		}
+
+		entries = append(entries, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return entries, metadata, nil
+}
+
+// insertAuditEntry records a change in the audit log as part of tx, so that the entry is only
+// kept if the change itself is committed. before and after are the JSON representations of
+// the entity, either of which may be nil for creates and deletes. Only the fields that differ
+// between them are stored.
+func insertAuditEntry(ctx context.Context, tx *sql.Tx, actor Actor, action, entityType string, entityID int, before, after any) error {
+	changes, err := diffJSON(before, after)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO audit_log (actor_id, ip, request_id, action, entity_type, entity_id, changes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`
+
+	var actorID *int
+	if actor.UserID != 0 {
+		actorID = &actor.UserID
+	}
+
+	// Pass the changes as a string, lib/pq would encode a []byte as bytea.
+	args := []any{actorID, actor.IP, actor.RequestID, action, entityType, entityID, string(changes)}
+
+	_, err = tx.ExecContext(ctx, query, args...)
+	return err
+}
+
+// diffJSON compares the top-level fields of the JSON representations of before and after and
+// returns the fields that changed, encoded as a JSON object of Change values.
+func diffJSON(before, after any) ([]byte, error) {
+	b, err := jsonFields(before)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := jsonFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]Change)
+	for field, value := range b {
+		if !bytes.Equal(value, a[field]) {
+			changes[field] = Change{Before: value, After: a[field]}
+		}
+	}
+	for field, value := range a {
+		if _, ok := b[field]; !ok {
+			changes[field] = Change{After: value}
+		}
+	}
+
+	return json.Marshal(changes)
+}
+
+func jsonFields(v any) (map[string]json.RawMessage, error) {
+	fields := make(map[string]json.RawMessage)
+	if v == nil {
+		return fields, nil
+	}
+
+	js, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(js, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
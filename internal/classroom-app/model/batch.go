@@ -0,0 +1,287 @@
+package model
+
+import (
+	"FinalProject/internal/classroom-app/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+)
+
+// Operations of a batch.
+const (
+	BatchCreate = "create"
+	BatchUpdate = "update"
+	BatchDelete = "delete"
+)
+
+// Types of records a batch operation works on.
+const (
+	BatchClassroom = "classroom"
+	BatchTask      = "task"
+)
+
+// ErrBatchAborted is the result of the operations of a transactional batch that were rolled
+// back or never run because another operation failed.
+var ErrBatchAborted = errors.New("batch aborted")
+
+// FieldErrors is the error of an operation whose fields failed validation, by field.
+type FieldErrors map[string]string
+
+func (e FieldErrors) Error() string {
+	return "failed validation"
+}
+
+// BatchOperation creates, updates or deletes one classroom or task. Updates only change the
+// fields that are set. Updates and deletes with a Version only go through if the record still
+// has that version.
+type BatchOperation struct {
+	Op          string     `json:"op"`
+	Type        string     `json:"type"`
+	Id          int        `json:"id"`
+	Version     int        `json:"version"`
+	Name        *string    `json:"name"`
+	Header      *string    `json:"header"`
+	Description *string    `json:"description"`
+	DueAt       *time.Time `json:"dueAt"`
+	Classrooms  []int      `json:"classrooms"`
+}
+
+// BatchResult is the outcome of one batch operation. Record is the created or updated
+// classroom or task.
+type BatchResult struct {
+	Record any
+	Err    error
+}
+
+type BatchModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+
+	Classrooms ClassroomModel
+	Tasks      TaskModel
+}
+
+// Run runs the operations in order and returns the result of each. A transactional batch runs
+// in one transaction that is rolled back as soon as an operation fails, and the other
+// operations then fail with ErrBatchAborted. Otherwise every operation runs in a transaction
+// of its own and failing operations don't stop the others. The returned error is only set if
+// the batch couldn't run at all.
+func (m BatchModel) Run(ops []*BatchOperation, transactional bool, actor Actor) ([]BatchResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	results := make([]BatchResult, len(ops))
+
+	if !transactional {
+		for i, op := range ops {
+			results[i] = m.runInTx(ctx, op, actor)
+		}
+		return results, nil
+	}
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	for i, op := range ops {
+		record, err := m.run(ctx, tx, op, actor)
+		if err != nil {
+			abort(results, i, err)
+			return results, nil
+		}
+		results[i].Record = record
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// abort marks every result of a transactional batch as aborted, except the one at failed.
+func abort(results []BatchResult, failed int, err error) {
+	for i := range results {
+		results[i] = BatchResult{Err: ErrBatchAborted}
+	}
+	results[failed].Err = err
+}
+
+func (m BatchModel) runInTx(ctx context.Context, op *BatchOperation, actor Actor) BatchResult {
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return BatchResult{Err: err}
+	}
+	defer tx.Rollback()
+
+	record, err := m.run(ctx, tx, op, actor)
+	if err != nil {
+		return BatchResult{Err: err}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return BatchResult{Err: err}
+	}
+	return BatchResult{Record: record}
+}
+
+func (m BatchModel) run(ctx context.Context, tx *sql.Tx, op *BatchOperation, actor Actor) (any, error) {
+	switch op.Type {
+	case BatchClassroom:
+		return m.runClassroom(ctx, tx, op, actor)
+	case BatchTask:
+		return m.runTask(ctx, tx, op, actor)
+	default:
+		return nil, FieldErrors{"type": "must be classroom or task"}
+	}
+}
+
+func (m BatchModel) runClassroom(ctx context.Context, tx *sql.Tx, op *BatchOperation, actor Actor) (any, error) {
+	classroom := &Classroom{}
+
+	switch op.Op {
+	case BatchCreate:
+		applyToClassroom(classroom, op)
+		if err := validateClassroom(classroom); err != nil {
+			return nil, err
+		}
+		if err := m.Classrooms.insert(ctx, tx, classroom, actor); err != nil {
+			return nil, err
+		}
+	case BatchUpdate:
+		before, err := m.Classrooms.getForUpdate(ctx, tx, op.Id)
+		if err != nil {
+			return nil, notFound(err)
+		}
+		if op.Version != 0 && before.Version != op.Version {
+			return nil, ErrEditConflict
+		}
+
+		classroom = before
+		applyToClassroom(classroom, op)
+		if err := validateClassroom(classroom); err != nil {
+			return nil, err
+		}
+		if err := m.Classrooms.update(ctx, tx, classroom, actor); err != nil {
+			return nil, err
+		}
+	case BatchDelete:
+		return nil, m.Classrooms.delete(ctx, tx, op.Id, op.Version, actor)
+	}
+	return classroom, nil
+}
+
+func (m BatchModel) runTask(ctx context.Context, tx *sql.Tx, op *BatchOperation, actor Actor) (any, error) {
+	task := &Task{}
+
+	switch op.Op {
+	case BatchCreate:
+		applyToTask(task, op)
+		if err := validateTask(task); err != nil {
+			return nil, err
+		}
+		if err := m.Tasks.insert(ctx, tx, task, actor, op.Classrooms...); err != nil {
+			return nil, err
+		}
+	case BatchUpdate:
+		before, err := m.Tasks.getForUpdate(ctx, tx, op.Id)
+		if err != nil {
+			return nil, notFound(err)
+		}
+		if op.Version != 0 && before.Version != op.Version {
+			return nil, ErrEditConflict
+		}
+
+		task = before
+		applyToTask(task, op)
+		if err := validateTask(task); err != nil {
+			return nil, err
+		}
+		if err := m.Tasks.update(ctx, tx, task, actor); err != nil {
+			return nil, err
+		}
+	case BatchDelete:
+		return nil, m.Tasks.delete(ctx, tx, op.Id, op.Version, actor)
+	}
+	return task, nil
+}
+
+func applyToClassroom(classroom *Classroom, op *BatchOperation) {
+	if op.Name != nil {
+		classroom.Name = *op.Name
+	}
+	if op.Description != nil {
+		classroom.Description = *op.Description
+	}
+}
+
+func applyToTask(task *Task, op *BatchOperation) {
+	if op.Header != nil {
+		task.Header = *op.Header
+	}
+	if op.Description != nil {
+		task.Description = *op.Description
+	}
+	if op.DueAt != nil {
+		task.DueAt = op.DueAt
+	}
+}
+
+func validateClassroom(classroom *Classroom) error {
+	v := validator.New()
+	if ValidateClassroom(v, classroom); !v.Valid() {
+		return FieldErrors(v.Errors)
+	}
+	return nil
+}
+
+func validateTask(task *Task) error {
+	v := validator.New()
+	if ValidateTask(v, task); !v.Valid() {
+		return FieldErrors(v.Errors)
+	}
+	return nil
+}
+
+// notFound turns sql.ErrNoRows into ErrRecordNotFound.
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrRecordNotFound
+	}
+	return err
+}
+
+// ValidateBatchOperation checks the shape of an operation: what it does, to what, and that
+// it only sets fields that record has.
+func ValidateBatchOperation(v *validator.Validator, op *BatchOperation) {
+	v.Check(validator.In(op.Op, BatchCreate, BatchUpdate, BatchDelete), "op", "must be create, update or delete")
+	v.Check(validator.In(op.Type, BatchClassroom, BatchTask), "type", "must be classroom or task")
+
+	if op.Op == BatchCreate {
+		v.Check(op.Id == 0, "id", "must not be provided when creating")
+		v.Check(op.Version == 0, "version", "must not be provided when creating")
+	} else {
+		v.Check(op.Id > 0, "id", "must be provided")
+		v.Check(op.Version >= 0, "version", "must not be negative")
+	}
+
+	if op.Op == BatchDelete {
+		fieldSet := op.Name != nil || op.Header != nil || op.Description != nil || op.DueAt != nil || op.Classrooms != nil
+		v.Check(!fieldSet, "op", "delete must not set any fields")
+		return
+	}
+
+	switch op.Type {
+	case BatchClassroom:
+		v.Check(op.Header == nil, "header", "is not a field of classrooms")
+		v.Check(op.DueAt == nil, "dueAt", "is not a field of classrooms")
+		v.Check(op.Classrooms == nil, "classrooms", "is not a field of classrooms")
+	case BatchTask:
+		v.Check(op.Name == nil, "name", "is not a field of tasks")
+		v.Check(op.Op == BatchCreate || op.Classrooms == nil, "classrooms", "can only be set when creating a task")
+	}
+}
@@ -4,18 +4,34 @@ import (
 	"FinalProject/internal/classroom-app/validator"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type Classroom struct {
 	Id          int    `json:"id"`
 	CreatedAt   string `json:"createdAt"`
+	UpdatedAt   string `json:"updatedAt"`
 	Name        string `json:"name"`
 	Description string `json:"description"`
+	Version     int    `json:"version"`
+	// TermId is the academic term of the classroom, if it has one.
+	TermId *int `json:"termId"`
+	// ArchivedAt is set while the classroom is archived and read-only.
+	ArchivedAt *time.Time `json:"archivedAt"`
 }
 
+// Which classrooms a classroom list shows, by whether they are archived.
+const (
+	ArchivedHide = "false"
+	ArchivedOnly = "true"
+	ArchivedAll  = "all"
+)
+
 type ClassroomModel struct {
 	DB       *sql.DB
 	InfoLog  *log.Logger
@@ -23,31 +39,68 @@ type ClassroomModel struct {
 }
 
 // Insert new classroom into the database
-func (c ClassroomModel) Insert(classroom *Classroom) error {
-	query := `
-		INSERT INTO classroom (name, description) 
-		VALUES($1, $2)
-		RETURNING id, created_at
-		`
+func (c ClassroomModel) Insert(classroom *Classroom, actor Actor) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	args := []any{classroom.Name, classroom.Description}
-	return c.DB.QueryRowContext(ctx, query, args...).Scan(&classroom.Id, &classroom.CreatedAt)
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = c.insert(ctx, tx, classroom, actor); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insert inserts the classroom and its audit entry as part of tx. The user who creates it
+// becomes its first teacher, as only teachers may manage a classroom's roster and attendance.
+func (c ClassroomModel) insert(ctx context.Context, tx *sql.Tx, classroom *Classroom, actor Actor) error {
+	query := `
+		INSERT INTO classroom (name, description, term_id) 
+		VALUES($1, $2, $3)
+		RETURNING id, created_at, updated_at, version
+		`
+
+	args := []any{classroom.Name, classroom.Description, classroom.TermId}
+	err := tx.QueryRowContext(ctx, query, args...).Scan(&classroom.Id, &classroom.CreatedAt, &classroom.UpdatedAt, &classroom.Version)
+	if err != nil {
+		return termNotFound(err)
+	}
+
+	err = insertAuditEntry(ctx, tx, actor, AuditCreate, EntityClassroom, classroom.Id, nil, classroom)
+	if err != nil {
+		return err
+	}
+
+	if actor.UserID == 0 {
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO classroom_members (class_id, user_id, role) VALUES ($1, $2, $3)`, classroom.Id, actor.UserID, RoleTeacher)
+	if err != nil {
+		return err
+	}
+
+	after := map[string]any{"user_id": actor.UserID, "role": RoleTeacher}
+	return insertAuditEntry(ctx, tx, actor, AuditCreate, EntityMember, classroom.Id, nil, after)
 }
 
 // Get classroom from the database
 func (c ClassroomModel) Get(id int) (*Classroom, error) {
 	query := `
-		SELECT id, name, description, created_at FROM classroom 
-		WHERE id = $1
+		SELECT id, name, description, created_at, updated_at, version, term_id, archived_at FROM classroom 
+		WHERE id = $1 AND deleted_at IS NULL
 		`
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	var classRoom Classroom
 	row := c.DB.QueryRowContext(ctx, query, id)
-	err := row.Scan(&classRoom.Id, &classRoom.Name, &classRoom.Description, &classRoom.CreatedAt)
+	err := row.Scan(&classRoom.Id, &classRoom.Name, &classRoom.Description, &classRoom.CreatedAt, &classRoom.UpdatedAt, &classRoom.Version, &classRoom.TermId, &classRoom.ArchivedAt)
 
 	if err != nil {
 		return nil, err
@@ -55,22 +108,39 @@ func (c ClassroomModel) Get(id int) (*Classroom, error) {
 	return &classRoom, nil
 }
 
-// Get all classrooms from the database
-func (c ClassroomModel) GetAll(name string, filters Filters) ([]*Classroom, Metadata, error) {
+// Get all classrooms from the database. Only the classrooms of the term are returned if termId
+// isn't 0, and archived says whether archived classrooms are hidden, the only ones returned or
+// returned together with the others.
+func (c ClassroomModel) GetAll(name string, termId int, archived string, filters Filters) ([]*Classroom, Metadata, error) {
+	keyset, keysetArgs := filters.keyset(filters.sortColumn(), "id", 6)
+	filter, filterArgs := filters.filterClause(6 + len(keysetArgs))
+
 	query := fmt.Sprintf(
 		`
-		SELECT count(*) OVER(), id, created_at, name, description
+		SELECT count(*) OVER(), id, created_at, updated_at, name, description, version, term_id, archived_at
 		FROM classroom
-		WHERE (LOWER(name) = LOWER($1) OR $1 = '')
-		ORDER BY %s %s, id ASC
+		WHERE deleted_at IS NULL
+			AND (LOWER(name) = LOWER($1) OR $1 = '')
+			AND (term_id = $4 OR $4 = 0)
+			AND CASE $5
+				WHEN 'true' THEN archived_at IS NOT NULL
+				WHEN 'all' THEN true
+				ELSE archived_at IS NULL
+			END
+			AND %s
+			AND %s
+		ORDER BY %s %s, id %s
 		LIMIT $2 OFFSET $3
 		`,
-		filters.sortColumn(), filters.sortDirection())
+		keyset, filter, filters.sortColumn(), filters.sortDirection(), filters.sortDirection())
 
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	args := []interface{}{name, filters.limit(), filters.offset()}
+	// Fetch one extra row to find out whether there is a next page.
+	args := []interface{}{name, filters.limit() + 1, filters.offset(), termId, archived}
+	args = append(args, keysetArgs...)
+	args = append(args, filterArgs...)
 
 	rows, err := c.DB.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -88,7 +158,7 @@ func (c ClassroomModel) GetAll(name string, filters Filters) ([]*Classroom, Meta
 	var classrooms []*Classroom
 	for rows.Next() {
 		var classroom Classroom
-		err := rows.Scan(&totalRecords, &classroom.Id, &classroom.CreatedAt, &classroom.Name, &classroom.Description)
+		err := rows.Scan(&totalRecords, &classroom.Id, &classroom.CreatedAt, &classroom.UpdatedAt, &classroom.Name, &classroom.Description, &classroom.Version, &classroom.TermId, &classroom.ArchivedAt)
 		if err != nil {
 			return nil, Metadata{}, err
 		}
@@ -100,37 +170,345 @@ func (c ClassroomModel) GetAll(name string, filters Filters) ([]*Classroom, Meta
 		return nil, Metadata{}, err
 	}
 
-	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	fetched := len(classrooms)
+	if fetched > filters.limit() {
+		classrooms = classrooms[:filters.limit()]
+	}
+
+	var metadata Metadata
+	if len(classrooms) > 0 {
+		last := classrooms[len(classrooms)-1]
+		metadata = calculateListMetadata(filters, totalRecords, fetched, last.Id, last.sortKey(filters.sortColumn()))
+	}
 
 	return classrooms, metadata, nil
 }
 
-// Update classroom in the database
-func (c ClassroomModel) Update(classroom *Classroom) error {
+// sortKey returns the value of the column the classroom list is sorted by.
+func (c *Classroom) sortKey(column string) string {
+	switch column {
+	case "name":
+		return c.Name
+	case "created_at":
+		return c.CreatedAt
+	default:
+		return strconv.Itoa(c.Id)
+	}
+}
+
+// getForUpdate reads a classroom that isn't deleted and locks it until tx ends.
+func (c ClassroomModel) getForUpdate(ctx context.Context, tx *sql.Tx, id int) (*Classroom, error) {
+	return c.getLocked(ctx, tx, id, "FOR UPDATE")
+}
+
+// getForShare reads a classroom that isn't deleted and keeps it from being changed or deleted
+// until tx ends, without keeping others from reading or sharing it.
+func (c ClassroomModel) getForShare(ctx context.Context, tx *sql.Tx, id int) (*Classroom, error) {
+	return c.getLocked(ctx, tx, id, "FOR SHARE")
+}
+
+func (c ClassroomModel) getLocked(ctx context.Context, tx *sql.Tx, id int, lock string) (*Classroom, error) {
+	query := `
+		SELECT id, name, description, created_at, updated_at, version, term_id, archived_at FROM classroom
+		WHERE id = $1 AND deleted_at IS NULL
+		` + lock
+
+	var classroom Classroom
+	err := tx.QueryRowContext(ctx, query, id).Scan(
+		&classroom.Id,
+		&classroom.Name,
+		&classroom.Description,
+		&classroom.CreatedAt,
+		&classroom.UpdatedAt,
+		&classroom.Version,
+		&classroom.TermId,
+		&classroom.ArchivedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &classroom, nil
+}
+
+// Update classroom in the database. The update only goes through if the version of the
+// classroom hasn't changed since it was read, otherwise ErrEditConflict is returned. Archived
+// classrooms can't be updated and return ErrArchived.
+func (c ClassroomModel) Update(classroom *Classroom, actor Actor) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = c.update(ctx, tx, classroom, actor); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// update updates the classroom and adds its audit entry as part of tx.
+func (c ClassroomModel) update(ctx context.Context, tx *sql.Tx, classroom *Classroom, actor Actor) error {
 	query := `
 		UPDATE classroom 
-		SET name=$1, description=$2
-		WHERE id=$3
+		SET name=$1, description=$2, term_id=$3, version=version+1
+		WHERE id=$4
+		RETURNING updated_at, version
 	`
+
+	before, err := c.getForUpdate(ctx, tx, classroom.Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	if before.Version != classroom.Version {
+		return ErrEditConflict
+	}
+	if before.ArchivedAt != nil {
+		return ErrArchived
+	}
+
+	args := []any{classroom.Name, classroom.Description, classroom.TermId, classroom.Id}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&classroom.UpdatedAt, &classroom.Version)
+	if err != nil {
+		return termNotFound(err)
+	}
+
+	return insertAuditEntry(ctx, tx, actor, AuditUpdate, EntityClassroom, classroom.Id, before, classroom)
+}
+
+// Delete moves the classroom to the trash of the user who deleted it. Its task links are kept
+// so that Restore can bring it back as it was. When version is not 0 the classroom is only
+// deleted if it still has that version, otherwise ErrEditConflict is returned.
+func (c ClassroomModel) Delete(id int, version int, actor Actor) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	args := []any{classroom.Name, classroom.Description, classroom.Id}
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = c.delete(ctx, tx, id, version, actor); err != nil {
+		return err
+	}
 
-	_, err := c.DB.ExecContext(ctx, query, args...)
-	return err
+	return tx.Commit()
 }
 
-// Delete classroom from database
-func (c ClassroomModel) Delete(id int) error {
+// delete moves the classroom to the trash and adds its audit entry as part of tx.
+func (c ClassroomModel) delete(ctx context.Context, tx *sql.Tx, id int, version int, actor Actor) error {
 	query := `
-		DELETE FROM classroom
+		UPDATE classroom
+		SET deleted_at=now(), deleted_by=$2, version=version+1
 		WHERE id=$1
 	`
+
+	before, err := c.getForUpdate(ctx, tx, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows) && version != 0:
+			return ErrEditConflict
+		case errors.Is(err, sql.ErrNoRows):
+			return nil
+		default:
+			return err
+		}
+	}
+
+	if version != 0 && before.Version != version {
+		return ErrEditConflict
+	}
+	if before.ArchivedAt != nil {
+		return ErrArchived
+	}
+
+	var deletedBy *int
+	if actor.UserID != 0 {
+		deletedBy = &actor.UserID
+	}
+
+	_, err = tx.ExecContext(ctx, query, id, deletedBy)
+	if err != nil {
+		return err
+	}
+
+	if err = releaseRooms(ctx, tx, id, actor); err != nil {
+		return err
+	}
+
+	return insertAuditEntry(ctx, tx, actor, AuditDelete, EntityClassroom, id, before, nil)
+}
+
+// releaseRooms takes the rooms away from the sessions of the classroom as part of tx, so that
+// a classroom in the trash doesn't keep others from booking them. A restored classroom gets its
+// sessions back without rooms.
+func releaseRooms(ctx context.Context, tx *sql.Tx, classId int, actor Actor) error {
+	query := `
+		UPDATE class_sessions s
+		SET room_id = NULL, version = s.version + 1
+		FROM class_sessions old
+		WHERE s.id = old.id AND s.class_id = $1 AND s.room_id IS NOT NULL
+		RETURNING s.id, old.room_id
+		`
+
+	rows, err := tx.QueryContext(ctx, query, classId)
+	if err != nil {
+		return err
+	}
+
+	var released [][2]int
+	for rows.Next() {
+		var sessionId, roomId int
+		if err := rows.Scan(&sessionId, &roomId); err != nil {
+			rows.Close()
+			return err
+		}
+		released = append(released, [2]int{sessionId, roomId})
+	}
+	if err = rows.Err(); err != nil {
+		rows.Close()
+		return err
+	}
+	if err = rows.Close(); err != nil {
+		return err
+	}
+
+	for _, session := range released {
+		before := map[string]any{"roomId": session[1]}
+		after := map[string]any{"roomId": nil}
+		if err := insertAuditEntry(ctx, tx, actor, AuditUpdate, EntitySession, session[0], before, after); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore takes a deleted classroom out of the trash. It returns ErrRecordNotFound if the
+// classroom doesn't exist or isn't deleted.
+func (c ClassroomModel) Restore(id int, actor Actor) (*Classroom, error) {
+	query := `
+		UPDATE classroom
+		SET deleted_at=NULL, deleted_by=NULL, version=version+1
+		WHERE id=$1 AND deleted_at IS NOT NULL
+		RETURNING id, name, description, created_at, updated_at, version, term_id, archived_at
+		`
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var classroom Classroom
+	err = tx.QueryRowContext(ctx, query, id).Scan(
+		&classroom.Id,
+		&classroom.Name,
+		&classroom.Description,
+		&classroom.CreatedAt,
+		&classroom.UpdatedAt,
+		&classroom.Version,
+		&classroom.TermId,
+		&classroom.ArchivedAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	err = insertAuditEntry(ctx, tx, actor, AuditRestore, EntityClassroom, id, nil, &classroom)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &classroom, nil
+}
+
+// SetArchived archives or unarchives the classroom. Archiving an archived classroom or
+// unarchiving one that isn't archived changes nothing. It returns ErrRecordNotFound if the
+// classroom doesn't exist or is deleted.
+func (c ClassroomModel) SetArchived(id int, archived bool, actor Actor) (*Classroom, error) {
+	query := `
+		UPDATE classroom
+		SET archived_at = CASE WHEN $2 THEN now() END, version = version + 1
+		WHERE id = $1
+		RETURNING archived_at, updated_at, version
+		`
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err := c.DB.ExecContext(ctx, query, id)
+	tx, err := c.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	before, err := c.getForUpdate(ctx, tx, id)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	if (before.ArchivedAt != nil) == archived {
+		return before, nil
+	}
+
+	classroom := *before
+	err = tx.QueryRowContext(ctx, query, id, archived).Scan(&classroom.ArchivedAt, &classroom.UpdatedAt, &classroom.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	err = insertAuditEntry(ctx, tx, actor, AuditUpdate, EntityClassroom, id, before, &classroom)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &classroom, nil
+}
+
+// IsArchived reports whether the classroom is archived. Classrooms that don't exist aren't.
+func (c ClassroomModel) IsArchived(id int) (bool, error) {
+	query := `SELECT archived_at IS NOT NULL FROM classroom WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var archived bool
+	err := c.DB.QueryRowContext(ctx, query, id).Scan(&archived)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return false, err
+	}
+	return archived, nil
+}
+
+// termNotFound turns the error of writing a classroom with a term that doesn't exist into
+// FieldErrors.
+func termNotFound(err error) error {
+	if strings.Contains(err.Error(), `"classroom_term_id_fkey"`) {
+		return FieldErrors{"termId": "term does not exist"}
+	}
 	return err
 }
 
@@ -138,4 +516,5 @@ func ValidateClassroom(v *validator.Validator, classroom *Classroom) {
 	v.Check(classroom.Name != "", "title", "must be provided")
 	v.Check(len(classroom.Name) <= 50, "title", "must be no more than 50 bytes long")
 	v.Check(len(classroom.Description) <= 1000, "description", "must be no more than 1000 bytes long")
+	v.Check(classroom.TermId == nil || *classroom.TermId > 0, "termId", "must be a valid term id")
 }
@@ -0,0 +1,228 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+)
+
+// cloneTimeout is how long cloning a classroom may take. It stays below the lease of background
+// jobs, so a clone that runs as a job isn't handed to a second worker while it runs.
+const cloneTimeout = 5 * time.Minute
+
+// CloneOptions says what the clone of a classroom gets. The name and description of the source
+// are used if Name or Description is nil, and its term if TermId is nil. The due dates of the
+// copied tasks are shifted by Offset, or if it is nil by the time between the start of the
+// source's term and the start of the clone's term. There are no options for announcements or
+// attachments because classrooms have neither.
+type CloneOptions struct {
+	Name        *string        `json:"name"`
+	Description *string        `json:"description"`
+	TermId      *int           `json:"termId"`
+	Tasks       bool           `json:"tasks"`
+	Teachers    bool           `json:"teachers"`
+	Offset      *time.Duration `json:"offset"`
+}
+
+// CloneResult is the classroom a clone created and what was copied into it.
+type CloneResult struct {
+	Classroom *Classroom `json:"classroom"`
+	Tasks     []*Task    `json:"tasks"`
+	Teachers  []int      `json:"teachers"`
+}
+
+type CloneModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+
+	Classrooms ClassroomModel
+	Tasks      TaskModel
+}
+
+// CountTasks returns how many tasks cloning the classroom with its tasks copies.
+func (m CloneModel) CountTasks(id int) (int, error) {
+	query := `
+		SELECT count(*) FROM classroom_task ct
+			INNER JOIN task t ON t.id = ct.task_id
+		WHERE ct.class_id = $1 AND t.deleted_at IS NULL
+		`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var count int
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&count)
+	return count, err
+}
+
+// Clone creates a new classroom from the classroom with the id, copying its tasks and teachers
+// if opts says so. Students are never copied. Everything is created in one transaction, and
+// progress is called after each copied task. It returns ErrRecordNotFound if the classroom
+// doesn't exist or is deleted, and FieldErrors if the clone or one of its tasks isn't valid.
+// The source may be archived, the clone never is.
+func (m CloneModel) Clone(id int, opts CloneOptions, actor Actor, progress func(done, total int)) (*CloneResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cloneTimeout)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// A shared lock keeps the source from changing while it is copied, which can take minutes,
+	// without blocking the tasks and members of the live classroom.
+	source, err := m.Classrooms.getForShare(ctx, tx, id)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	classroom := &Classroom{
+		Name:        source.Name,
+		Description: source.Description,
+		TermId:      source.TermId,
+	}
+	if opts.Name != nil {
+		classroom.Name = *opts.Name
+	}
+	if opts.Description != nil {
+		classroom.Description = *opts.Description
+	}
+	if opts.TermId != nil {
+		classroom.TermId = opts.TermId
+	}
+
+	if err := validateClassroom(classroom); err != nil {
+		return nil, err
+	}
+	if err := m.Classrooms.insert(ctx, tx, classroom, actor); err != nil {
+		return nil, err
+	}
+
+	result := &CloneResult{Classroom: classroom, Tasks: []*Task{}, Teachers: []int{}}
+
+	if opts.Tasks {
+		offset, err := cloneOffset(ctx, tx, source, classroom, opts.Offset)
+		if err != nil {
+			return nil, err
+		}
+
+		result.Tasks, err = m.copyTasks(ctx, tx, source.Id, classroom.Id, offset, actor, progress)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Teachers {
+		result.Teachers, err = copyTeachers(ctx, tx, source.Id, classroom.Id, actor)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// cloneOffset returns offset if it is set, otherwise the time between the starts of the terms
+// of the source and the clone. It is 0 if one of them has no term.
+func cloneOffset(ctx context.Context, tx *sql.Tx, source, clone *Classroom, offset *time.Duration) (time.Duration, error) {
+	if offset != nil {
+		return *offset, nil
+	}
+	if source.TermId == nil || clone.TermId == nil {
+		return 0, nil
+	}
+
+	query := `
+		SELECT (SELECT starts_on FROM terms WHERE id = $2) - (SELECT starts_on FROM terms WHERE id = $1)
+		`
+
+	var days sql.NullInt64
+	if err := tx.QueryRowContext(ctx, query, *source.TermId, *clone.TermId).Scan(&days); err != nil {
+		return 0, err
+	}
+	return time.Duration(days.Int64) * 24 * time.Hour, nil
+}
+
+// copyTasks copies the tasks of the source classroom into the clone as part of tx, each as a
+// task of its own even if the source shares it with other classrooms.
+func (m CloneModel) copyTasks(ctx context.Context, tx *sql.Tx, sourceId, cloneId int, offset time.Duration, actor Actor, progress func(done, total int)) ([]*Task, error) {
+	query := `
+		SELECT t.id, t.header, t.description, t.created_at, t.updated_at, t.version, t.due_at
+		FROM task t
+			INNER JOIN classroom_task ct ON ct.task_id = t.id
+		WHERE ct.class_id = $1 AND t.deleted_at IS NULL
+		ORDER BY t.id
+		`
+
+	rows, err := tx.QueryContext(ctx, query, sourceId)
+	if err != nil {
+		return nil, err
+	}
+
+	var sources []*Task
+	for rows.Next() {
+		var task Task
+		err := rows.Scan(&task.Id, &task.Header, &task.Description, &task.CreatedAt, &task.UpdatedAt, &task.Version, &task.DueAt)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		sources = append(sources, &task)
+	}
+	if err = rows.Err(); err != nil {
+		rows.Close()
+		return nil, err
+	}
+	if err = rows.Close(); err != nil {
+		return nil, err
+	}
+
+	tasks := make([]*Task, 0, len(sources))
+	for i, source := range sources {
+		copies, err := m.Tasks.insertCopies(ctx, tx, source, []int{cloneId}, offset, actor)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, copies...)
+
+		if progress != nil {
+			progress(i+1, len(sources))
+		}
+	}
+	return tasks, nil
+}
+
+// copyTeachers makes the teachers of the source classroom teachers of the clone as part of tx
+// and returns their user ids. The user who cloned it already is one and isn't returned.
+func copyTeachers(ctx context.Context, tx *sql.Tx, sourceId, cloneId int, actor Actor) ([]int, error) {
+	query := `
+		INSERT INTO classroom_members (class_id, user_id, role)
+		SELECT $2, user_id, role FROM classroom_members
+		WHERE class_id = $1 AND role = 'teacher'
+		ORDER BY user_id
+		ON CONFLICT DO NOTHING
+		RETURNING user_id
+		`
+
+	rows, err := tx.QueryContext(ctx, query, sourceId, cloneId)
+	if err != nil {
+		return nil, err
+	}
+	teachers, err := scanIds(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, userId := range teachers {
+		after := map[string]any{"user_id": userId, "role": RoleTeacher}
+		if err := insertAuditEntry(ctx, tx, actor, AuditCreate, EntityMember, cloneId, nil, after); err != nil {
+			return nil, err
+		}
+	}
+	return teachers, nil
+}
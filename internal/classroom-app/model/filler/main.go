@@ -7,7 +7,7 @@ import (
 
 func PopulateDatabase(models model.Models) error {
 	for _, class := range classrooms {
-		err := models.Classrooms.Insert(&class)
+		err := models.Classrooms.Insert(&class, model.Actor{})
 		if err != nil {
 			return err
 		}
@@ -17,7 +17,7 @@ func PopulateDatabase(models model.Models) error {
 				Header:      "task #" + strconv.Itoa(i),
 				Description: "task in a " + class.Name,
 			}
-			err = models.Tasks.Insert(&task, class.Id)
+			err = models.Tasks.Insert(&task, model.Actor{}, class.Id)
 		}
 
 	}
@@ -0,0 +1,337 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// FilterType is the type of a filterable field. It decides which operators are allowed and how
+// the value is parsed before it is sent to the database.
+type FilterType int
+
+const (
+	FilterText FilterType = iota
+	FilterInt
+	FilterTime
+)
+
+// FilterField describes a field that may be used in a filter expression. Column is inserted
+// into the SQL as is, so it must never come from user input.
+type FilterField struct {
+	Column string
+	Type   FilterType
+}
+
+const maxFilterTerms = 20
+
+var filterOperators = map[FilterType][]string{
+	FilterText: {"=", "!=", "~", "!~"},
+	FilterInt:  {"=", "!=", ">", ">=", "<", "<="},
+	FilterTime: {"=", "!=", ">", ">=", "<", "<="},
+}
+
+type filterTokenKind int
+
+const (
+	tokenEOF filterTokenKind = iota
+	tokenWord
+	tokenString
+	tokenOperator
+	tokenAnd
+	tokenOr
+	tokenLParen
+	tokenRParen
+)
+
+type filterToken struct {
+	kind filterTokenKind
+	text string
+	pos  int
+}
+
+// FilterError reports the token of a filter expression that could not be parsed.
+type FilterError struct {
+	Token    string
+	Position int
+	Message  string
+}
+
+func (e *FilterError) Error() string {
+	if e.Token == "" {
+		return fmt.Sprintf("%s at position %d", e.Message, e.Position)
+	}
+	return fmt.Sprintf("%s near %q at position %d", e.Message, e.Token, e.Position)
+}
+
+// lexFilter splits a filter expression such as `name~calc AND created_at>=2024-01-01` into
+// tokens. Positions are 1-based so they can be shown to the client as is.
+func lexFilter(s string) ([]filterToken, error) {
+	var tokens []filterToken
+	runes := []rune(s)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		pos := i + 1
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case r == '(':
+			tokens = append(tokens, filterToken{kind: tokenLParen, text: "(", pos: pos})
+			i++
+
+		case r == ')':
+			tokens = append(tokens, filterToken{kind: tokenRParen, text: ")", pos: pos})
+			i++
+
+		case strings.ContainsRune("=!~<>", r):
+			op := string(r)
+			if i+1 < len(runes) && (runes[i+1] == '=' || (r == '!' && runes[i+1] == '~')) {
+				op += string(runes[i+1])
+			}
+			if op == "!" {
+				return nil, &FilterError{Token: op, Position: pos, Message: "unknown operator"}
+			}
+			tokens = append(tokens, filterToken{kind: tokenOperator, text: op, pos: pos})
+			i += len([]rune(op))
+
+		case r == '"':
+			var sb strings.Builder
+			j := i + 1
+			for ; j < len(runes) && runes[j] != '"'; j++ {
+				if runes[j] == '\\' && j+1 < len(runes) {
+					j++
+				}
+				sb.WriteRune(runes[j])
+			}
+			if j == len(runes) {
+				return nil, &FilterError{Token: string(runes[i:]), Position: pos, Message: "unterminated string"}
+			}
+			tokens = append(tokens, filterToken{kind: tokenString, text: sb.String(), pos: pos})
+			i = j + 1
+
+		default:
+			j := i
+			for j < len(runes) && !unicode.IsSpace(runes[j]) && !strings.ContainsRune(`()=!~<>"`, runes[j]) {
+				j++
+			}
+			word := string(runes[i:j])
+
+			kind := tokenWord
+			switch strings.ToUpper(word) {
+			case "AND":
+				kind = tokenAnd
+			case "OR":
+				kind = tokenOr
+			}
+			tokens = append(tokens, filterToken{kind: kind, text: word, pos: pos})
+			i = j
+		}
+	}
+
+	return append(tokens, filterToken{kind: tokenEOF, pos: len(runes) + 1}), nil
+}
+
+// filterParser is a recursive descent parser that compiles a filter expression straight into
+// a parameterized SQL condition. Values only ever end up in args.
+type filterParser struct {
+	tokens   []filterToken
+	current  int
+	fields   map[string]FilterField
+	argPos   int
+	args     []any
+	numTerms int
+}
+
+// compileFilter parses expr against the allowed fields and returns the SQL condition with its
+// arguments, which are numbered from argPos.
+//
+//	expr = and { "OR" and }
+//	and  = term { "AND" term }
+//	term = "(" expr ")" | field operator value
+func compileFilter(expr string, fields map[string]FilterField, argPos int) (string, []any, error) {
+	tokens, err := lexFilter(expr)
+	if err != nil {
+		return "", nil, err
+	}
+
+	p := &filterParser{tokens: tokens, fields: fields, argPos: argPos}
+
+	sql, err := p.parseOr()
+	if err != nil {
+		return "", nil, err
+	}
+
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return "", nil, p.unexpected(tok)
+	}
+
+	return sql, p.args, nil
+}
+
+func (p *filterParser) peek() filterToken {
+	return p.tokens[p.current]
+}
+
+func (p *filterParser) next() filterToken {
+	tok := p.tokens[p.current]
+	if tok.kind != tokenEOF {
+		p.current++
+	}
+	return tok
+}
+
+func (p *filterParser) unexpected(tok filterToken) error {
+	if tok.kind == tokenEOF {
+		return &FilterError{Position: tok.pos, Message: "unexpected end of filter"}
+	}
+	return &FilterError{Token: tok.text, Position: tok.pos, Message: "unexpected token"}
+}
+
+func (p *filterParser) parseOr() (string, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return "", err
+	}
+
+	for p.peek().kind == tokenOr {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return "", err
+		}
+		left = "(" + left + " OR " + right + ")"
+	}
+
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (string, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return "", err
+	}
+
+	for p.peek().kind == tokenAnd {
+		p.next()
+		right, err := p.parseTerm()
+		if err != nil {
+			return "", err
+		}
+		left = left + " AND " + right
+	}
+
+	return left, nil
+}
+
+func (p *filterParser) parseTerm() (string, error) {
+	tok := p.next()
+
+	if tok.kind == tokenLParen {
+		inner, err := p.parseOr()
+		if err != nil {
+			return "", err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return "", p.unexpected(closing)
+		}
+		return "(" + inner + ")", nil
+	}
+
+	if tok.kind != tokenWord {
+		return "", p.unexpected(tok)
+	}
+
+	field, ok := p.fields[tok.text]
+	if !ok {
+		return "", &FilterError{Token: tok.text, Position: tok.pos, Message: "unknown filter field"}
+	}
+
+	p.numTerms++
+	if p.numTerms > maxFilterTerms {
+		return "", &FilterError{Token: tok.text, Position: tok.pos, Message: fmt.Sprintf("too many conditions, the maximum is %d", maxFilterTerms)}
+	}
+
+	op := p.next()
+	if op.kind != tokenOperator {
+		return "", p.unexpected(op)
+	}
+
+	allowed := false
+	for _, o := range filterOperators[field.Type] {
+		allowed = allowed || o == op.text
+	}
+	if !allowed {
+		return "", &FilterError{Token: op.text, Position: op.pos, Message: fmt.Sprintf("operator not supported for field %q", tok.text)}
+	}
+
+	valueTok := p.next()
+	if valueTok.kind != tokenWord && valueTok.kind != tokenString {
+		return "", p.unexpected(valueTok)
+	}
+
+	value, err := parseFilterValue(field.Type, valueTok.text)
+	if err != nil {
+		return "", &FilterError{Token: valueTok.text, Position: valueTok.pos, Message: err.Error()}
+	}
+
+	placeholder := fmt.Sprintf("$%d", p.argPos+len(p.args))
+
+	var sql string
+	switch op.text {
+	case "=":
+		if field.Type == FilterText {
+			sql = fmt.Sprintf("LOWER(%s) = LOWER(%s)", field.Column, placeholder)
+		} else {
+			sql = fmt.Sprintf("%s = %s", field.Column, placeholder)
+		}
+	case "!=":
+		if field.Type == FilterText {
+			sql = fmt.Sprintf("LOWER(%s) <> LOWER(%s)", field.Column, placeholder)
+		} else {
+			sql = fmt.Sprintf("%s <> %s", field.Column, placeholder)
+		}
+	case "~":
+		sql = fmt.Sprintf("%s ILIKE %s", field.Column, placeholder)
+		value = "%" + escapeLike(valueTok.text) + "%"
+	case "!~":
+		sql = fmt.Sprintf("%s NOT ILIKE %s", field.Column, placeholder)
+		value = "%" + escapeLike(valueTok.text) + "%"
+	default:
+		sql = fmt.Sprintf("%s %s %s", field.Column, op.text, placeholder)
+	}
+
+	p.args = append(p.args, value)
+	return sql, nil
+}
+
+func parseFilterValue(t FilterType, s string) (any, error) {
+	switch t {
+	case FilterInt:
+		i, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, fmt.Errorf("must be an integer value")
+		}
+		return i, nil
+
+	case FilterTime:
+		for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+			if tm, err := time.Parse(layout, s); err == nil {
+				return tm, nil
+			}
+		}
+		return nil, fmt.Errorf("must be a date (2006-01-02) or RFC 3339 timestamp")
+
+	default:
+		return s, nil
+	}
+}
+
+// escapeLike escapes the LIKE wildcards in s so that it is matched literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
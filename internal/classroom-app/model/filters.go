@@ -2,8 +2,13 @@ package model
 
 import (
 	"FinalProject/internal/classroom-app/validator"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
 	"math"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Filters struct {
@@ -11,14 +16,49 @@ type Filters struct {
 	PageSize     int
 	Sort         string
 	SortSafeList []string
+	// Cursor is the opaque next_cursor value of a previous page. When it is set the list is
+	// paginated by keyset instead of OFFSET and Page is ignored.
+	Cursor string
+	// Filter is a filter expression such as `name~calc AND created_at>=2024-01-01`. Only the
+	// fields in FilterSafeList may be used in it.
+	Filter         string
+	FilterSafeList map[string]FilterField
 }
 
 type Metadata struct {
-	CurrentPage  int `json:"current_page,omitempty"`
-	PageSize     int `json:"page_size,omitempty"`
-	FirstPage    int `json:"first_page,omitempty"`
-	LastPage     int `json:"last_page,omitempty"`
-	TotalRecords int `json:"total_records,omitempty"`
+	CurrentPage  int    `json:"current_page,omitempty"`
+	PageSize     int    `json:"page_size,omitempty"`
+	FirstPage    int    `json:"first_page,omitempty"`
+	LastPage     int    `json:"last_page,omitempty"`
+	TotalRecords int    `json:"total_records,omitempty"`
+	NextCursor   string `json:"next_cursor,omitempty"`
+}
+
+// cursor is the decoded form of Filters.Cursor. It remembers the sort it was issued for, the
+// sort key of the last row on the page and that row's id as a tie-breaker.
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	Id    int    `json:"i"`
+}
+
+func encodeCursor(sort, value string, id int) string {
+	js, _ := json.Marshal(cursor{Sort: sort, Value: value, Id: id})
+	return base64.RawURLEncoding.EncodeToString(js)
+}
+
+func decodeCursor(s string) (*cursor, error) {
+	js, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var c cursor
+	if err := json.Unmarshal(js, &c); err != nil {
+		return nil, err
+	}
+
+	return &c, nil
 }
 
 func calculateMetadata(totalRecords, page, pageSize int) Metadata {
@@ -35,6 +75,24 @@ func calculateMetadata(totalRecords, page, pageSize int) Metadata {
 	}
 }
 
+// calculateListMetadata builds the metadata for a list query that fetched one row more than
+// the page size. lastId and lastKey describe the last row of the page and are encoded into
+// next_cursor when more rows follow it.
+func calculateListMetadata(filters Filters, totalRecords, fetched int, lastId int, lastKey string) Metadata {
+	var metadata Metadata
+	if filters.Cursor == "" {
+		metadata = calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+	} else {
+		metadata = Metadata{PageSize: filters.PageSize}
+	}
+
+	if fetched > filters.PageSize {
+		metadata.NextCursor = encodeCursor(filters.Sort, lastKey, lastId)
+	}
+
+	return metadata
+}
+
 func ValidateFilters(v *validator.Validator, f Filters) {
 	v.Check(f.Page > 0, "page", "must be greater than 0")
 	v.Check(f.Page <= 10_000_0000, "", "must be a maximum of 10 million")
@@ -42,6 +100,45 @@ func ValidateFilters(v *validator.Validator, f Filters) {
 	v.Check(f.PageSize <= 100, "page_size", "must be a maximum of 100")
 
 	v.Check(validator.In(f.Sort, f.SortSafeList...), "sort", "invalid sort value")
+
+	if f.Cursor != "" {
+		v.Check(f.Page == 1, "page", "must not be combined with cursor")
+
+		c, err := decodeCursor(f.Cursor)
+		if err != nil {
+			v.AddError("cursor", "invalid cursor")
+			return
+		}
+		v.Check(c.Sort == f.Sort, "cursor", "was issued for a different sort value")
+		v.Check(validCursorValue(strings.TrimPrefix(c.Sort, "-"), c.Value), "cursor", "invalid cursor")
+	}
+
+	if f.Filter != "" {
+		v.Check(len(f.Filter) <= 500, "filter", "must be no more than 500 bytes long")
+
+		if _, _, err := compileFilter(f.Filter, f.FilterSafeList, 1); err != nil {
+			v.AddError("filter", err.Error())
+		}
+	}
+}
+
+// validCursorValue reports whether value is a valid sort key for the sort column, so that a
+// tampered cursor can't make keyset's comparison fail in the database.
+func validCursorValue(column, value string) bool {
+	switch column {
+	case "id":
+		_, err := strconv.Atoi(value)
+		return err == nil
+	case "date", "created_at", "updated_at", "deleted_at":
+		// Timestamp columns scanned into strings are formatted like this.
+		_, err := time.Parse(time.RFC3339Nano, value)
+		return err == nil
+	case "starts_on":
+		_, err := time.Parse(dateLayout, value)
+		return err == nil
+	default:
+		return true
+	}
 }
 
 func (f Filters) sortColumn() string {
@@ -66,5 +163,48 @@ func (f Filters) limit() int {
 }
 
 func (f Filters) offset() int {
+	if f.Cursor != "" {
+		return 0
+	}
 	return (f.Page - 1) * f.PageSize
 }
+
+// keyset returns the WHERE condition that continues a list after the cursor, together with
+// its arguments, which are numbered from argPos. The row comparison only works because lists
+// break ties by id in the same direction as the sort column. It returns "TRUE" when no cursor
+// is set. column and idColumn must be trusted SQL identifiers.
+func (f Filters) keyset(column, idColumn string, argPos int) (string, []any) {
+	if f.Cursor == "" {
+		return "TRUE", nil
+	}
+
+	// ValidateFilters has already made sure the cursor decodes.
+	c, err := decodeCursor(f.Cursor)
+	if err != nil {
+		panic("unvalidated cursor parameter:" + f.Cursor)
+	}
+
+	op := ">"
+	if f.sortDirection() == "DESC" {
+		op = "<"
+	}
+
+	clause := fmt.Sprintf("(%s, %s) %s ($%d, $%d)", column, idColumn, op, argPos, argPos+1)
+	return clause, []any{c.Value, c.Id}
+}
+
+// filterClause compiles the filter expression into an SQL condition with its arguments, which
+// are numbered from argPos. It returns "TRUE" when there is no filter.
+func (f Filters) filterClause(argPos int) (string, []any) {
+	if f.Filter == "" {
+		return "TRUE", nil
+	}
+
+	// ValidateFilters has already made sure the expression compiles.
+	clause, args, err := compileFilter(f.Filter, f.FilterSafeList, argPos)
+	if err != nil {
+		panic("unvalidated filter parameter:" + f.Filter)
+	}
+
+	return clause, args
+}
@@ -0,0 +1,355 @@
+package model
+
+import (
+	"FinalProject/internal/classroom-app/validator"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+)
+
+// Statuses of a job.
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	// JobDead is the status of a job that failed max_attempts times. It stays in the table
+	// until it is retried by hand.
+	JobDead = "dead"
+)
+
+// DefaultJobAttempts is how often a job is tried if it doesn't set MaxAttempts.
+const DefaultJobAttempts = 5
+
+type Job struct {
+	Id          int64           `json:"id"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	UniqueKey   *string         `json:"unique_key"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	RunAt       time.Time       `json:"run_at"`
+	LastError   string          `json:"last_error"`
+	FinishedAt  *time.Time      `json:"finished_at"`
+	// UserID is the user who started the job, if it was started by a request.
+	UserID *int `json:"user_id"`
+	// Progress and Total tell how far a long running job is, for the jobs that report it.
+	Progress int `json:"progress"`
+	Total    int `json:"total"`
+	// Result is what a job that succeeded produced, for the jobs that produce something.
+	Result json.RawMessage `json:"result"`
+}
+
+type JobModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+}
+
+// Enqueue adds a job to the queue. A zero RunAt runs it as soon as possible, and a Total is
+// stored with the job so workers can report progress against it right away. If the job has a
+// UniqueKey and a job with that key is already pending or running, nothing is added and the
+// Id of job stays 0.
+func (m JobModel) Enqueue(job *Job) error {
+	query := `
+		INSERT INTO jobs (kind, payload, unique_key, max_attempts, run_at, user_id, total)
+		VALUES ($1, $2, $3, $4, COALESCE($5, now()), $6, $7)
+		ON CONFLICT (unique_key) WHERE status IN ('pending', 'running') DO NOTHING
+		RETURNING id, created_at, status, attempts, run_at
+		`
+
+	if job.Payload == nil {
+		job.Payload = json.RawMessage("{}")
+	}
+	if job.MaxAttempts == 0 {
+		job.MaxAttempts = DefaultJobAttempts
+	}
+
+	var runAt *time.Time
+	if !job.RunAt.IsZero() {
+		runAt = &job.RunAt
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Pass the payload as a string, lib/pq would encode a json.RawMessage as bytea.
+	args := []any{job.Kind, string(job.Payload), job.UniqueKey, job.MaxAttempts, runAt, job.UserID, job.Total}
+
+	err := m.DB.QueryRowContext(ctx, query, args...).Scan(&job.Id, &job.CreatedAt, &job.Status, &job.Attempts, &job.RunAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	return err
+}
+
+// Claim locks the next due job for the caller and marks it running. Jobs that have been
+// running for longer than lease are assumed to belong to a worker that died and are claimed
+// again. It returns nil if no job is due.
+func (m JobModel) Claim(lease time.Duration) (*Job, error) {
+	query := `
+		UPDATE jobs
+		SET status = 'running', attempts = attempts + 1, locked_at = now()
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE (status = 'pending' AND run_at <= now())
+				OR (status = 'running' AND locked_at < now() - make_interval(secs => $1))
+			ORDER BY run_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, created_at, kind, payload, unique_key, status, attempts, max_attempts, run_at, last_error, user_id
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var job Job
+	err := m.DB.QueryRowContext(ctx, query, lease.Seconds()).Scan(
+		&job.Id,
+		&job.CreatedAt,
+		&job.Kind,
+		&job.Payload,
+		&job.UniqueKey,
+		&job.Status,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&job.RunAt,
+		&job.LastError,
+		&job.UserID,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, nil
+		default:
+			return nil, err
+		}
+	}
+
+	return &job, nil
+}
+
+// Complete marks a claimed job as succeeded.
+func (m JobModel) Complete(job *Job) error {
+	query := `
+		UPDATE jobs
+		SET status = 'succeeded', locked_at = NULL, last_error = '', finished_at = now()
+		WHERE id = $1
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, query, job.Id)
+	return err
+}
+
+// Fail records a failed run of a claimed job. It is retried with exponential backoff until it
+// has been tried MaxAttempts times, after which it is dead-lettered.
+func (m JobModel) Fail(job *Job, jobErr error) error {
+	job.LastError = jobErr.Error()
+
+	if job.Attempts >= job.MaxAttempts {
+		now := time.Now()
+		job.Status = JobDead
+		job.FinishedAt = &now
+	} else {
+		job.Status = JobPending
+		job.RunAt = time.Now().Add(retryBackoff(job.Attempts))
+	}
+
+	query := `
+		UPDATE jobs
+		SET status = $2, run_at = $3, last_error = $4, finished_at = $5, locked_at = NULL
+		WHERE id = $1
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{job.Id, job.Status, job.RunAt, job.LastError, job.FinishedAt}
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+// GetAll returns the jobs with the given status, or all jobs if status is empty, newest first.
+func (m JobModel) GetAll(status string, filters Filters) ([]*Job, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), id, created_at, kind, payload, unique_key, status, attempts,
+			max_attempts, run_at, last_error, finished_at, user_id, progress, total, result
+		FROM jobs
+		WHERE status = $1 OR $1 = ''
+		ORDER BY id DESC
+		LIMIT $2 OFFSET $3
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, status, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	totalRecords := 0
+
+	jobs := []*Job{}
+	for rows.Next() {
+		var job Job
+		err := rows.Scan(
+			&totalRecords,
+			&job.Id,
+			&job.CreatedAt,
+			&job.Kind,
+			&job.Payload,
+			&job.UniqueKey,
+			&job.Status,
+			&job.Attempts,
+			&job.MaxAttempts,
+			&job.RunAt,
+			&job.LastError,
+			&job.FinishedAt,
+			&job.UserID,
+			&job.Progress,
+			&job.Total,
+			&job.Result,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		jobs = append(jobs, &job)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return jobs, metadata, nil
+}
+
+// Get returns the job with the id, or ErrRecordNotFound.
+func (m JobModel) Get(id int64) (*Job, error) {
+	query := `
+		SELECT id, created_at, kind, payload, unique_key, status, attempts, max_attempts, run_at,
+			last_error, finished_at, user_id, progress, total, result
+		FROM jobs
+		WHERE id = $1
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var job Job
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(
+		&job.Id,
+		&job.CreatedAt,
+		&job.Kind,
+		&job.Payload,
+		&job.UniqueKey,
+		&job.Status,
+		&job.Attempts,
+		&job.MaxAttempts,
+		&job.RunAt,
+		&job.LastError,
+		&job.FinishedAt,
+		&job.UserID,
+		&job.Progress,
+		&job.Total,
+		&job.Result,
+	)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	return &job, nil
+}
+
+// SetProgress records that a running job has done progress of total steps. It is written
+// outside of the transaction the job may run in, so it can be read while the job runs.
+func (m JobModel) SetProgress(id int64, progress, total int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err := m.DB.ExecContext(ctx, `UPDATE jobs SET progress = $2, total = $3 WHERE id = $1`, id, progress, total)
+	return err
+}
+
+// SetResult records what a running job produced.
+func (m JobModel) SetResult(id int64, result any) error {
+	js, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Pass the result as a string, lib/pq would encode a []byte as bytea.
+	_, err = m.DB.ExecContext(ctx, `UPDATE jobs SET result = $2 WHERE id = $1`, id, string(js))
+	return err
+}
+
+// Retry puts a dead job back in the queue with a fresh set of attempts. It returns
+// ErrRecordNotFound if there is no dead job with the id.
+func (m JobModel) Retry(id int64) error {
+	query := `
+		UPDATE jobs
+		SET status = 'pending', attempts = 0, run_at = now(), finished_at = NULL
+		WHERE id = $1 AND status = 'dead'
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// DeleteSucceeded removes the jobs that succeeded more than olderThan ago and returns how many
+// were deleted. Dead jobs are kept until they are retried.
+func (m JobModel) DeleteSucceeded(olderThan time.Duration) (int64, error) {
+	query := `
+		DELETE FROM jobs
+		WHERE status = 'succeeded' AND finished_at < $1
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, time.Now().Add(-olderThan))
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+func ValidateJobStatus(v *validator.Validator, status string) {
+	v.Check(status == "" || validator.In(status, JobPending, JobRunning, JobSucceeded, JobDead), "status", "must be pending, running, succeeded or dead")
+}
@@ -0,0 +1,268 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+)
+
+// Roles of a classroom member.
+const (
+	RoleStudent = "student"
+	RoleTeacher = "teacher"
+)
+
+// Outcomes of importing a roster row.
+const (
+	RosterCreated     = "created"
+	RosterEnrolled    = "enrolled"
+	RosterRoleChanged = "role_changed"
+	RosterUnchanged   = "unchanged"
+	RosterInvalid     = "invalid"
+)
+
+// invitationTTL is how long imported users have to accept their invitation.
+const invitationTTL = 7 * 24 * time.Hour
+
+type Member struct {
+	UserID     int       `json:"user_id"`
+	FirstName  string    `json:"first_name"`
+	LastName   string    `json:"last_name"`
+	Email      string    `json:"email"`
+	Role       string    `json:"role"`
+	Activated  bool      `json:"activated"`
+	EnrolledAt time.Time `json:"enrolled_at"`
+}
+
+// RosterEntry is a valid row of a roster to import. User only needs the name, email and
+// password to be set.
+type RosterEntry struct {
+	Row  int
+	User *User
+	Role string
+}
+
+// RosterResult is the outcome of importing one row of a roster.
+type RosterResult struct {
+	Row            int               `json:"row"`
+	Email          string            `json:"email"`
+	Role           string            `json:"role,omitempty"`
+	UserID         int               `json:"user_id,omitempty"`
+	Status         string            `json:"status"`
+	Errors         map[string]string `json:"errors,omitempty"`
+	InvitationCode string            `json:"invitation_code,omitempty"`
+}
+
+type MemberModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+}
+
+// GetAll returns the members of a classroom ordered by role, last and first name.
+func (m MemberModel) GetAll(classId int) ([]*Member, error) {
+	query := `
+		SELECT u.id, u.first_name, u.last_name, u.email, cm.role, u.activated, cm.created_at
+		FROM classroom_members cm
+			INNER JOIN users u ON u.id = cm.user_id
+		WHERE cm.class_id = $1
+		ORDER BY cm.role DESC, u.last_name, u.first_name, u.id
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, classId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	members := []*Member{}
+	for rows.Next() {
+		var member Member
+		err := rows.Scan(
+			&member.UserID,
+			&member.FirstName,
+			&member.LastName,
+			&member.Email,
+			&member.Role,
+			&member.Activated,
+			&member.EnrolledAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, &member)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return members, nil
+}
+
+// GetRole returns the role of the user in the classroom. It returns ErrRecordNotFound if the
+// user isn't a member of it.
+func (m MemberModel) GetRole(classId, userID int) (string, error) {
+	query := `
+		SELECT role
+		FROM classroom_members
+		WHERE class_id = $1 AND user_id = $2
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var role string
+	err := m.DB.QueryRowContext(ctx, query, classId, userID).Scan(&role)
+	if err != nil {
+		return "", notFound(err)
+	}
+	return role, nil
+}
+
+// TeachesTask reports whether the user is a teacher of one of the classrooms of the task that
+// aren't in the trash.
+func (m MemberModel) TeachesTask(taskId, userID int) (bool, error) {
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM classroom_task ct
+				INNER JOIN classroom c ON c.id = ct.class_id AND c.deleted_at IS NULL
+				INNER JOIN classroom_members cm ON cm.class_id = ct.class_id
+			WHERE ct.task_id = $1 AND cm.user_id = $2 AND cm.role = 'teacher'
+		)
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var teaches bool
+	err := m.DB.QueryRowContext(ctx, query, taskId, userID).Scan(&teaches)
+	return teaches, err
+}
+
+// ImportRoster enrolls everyone in entries in the classroom with their role. Users that don't
+// exist yet are created unactivated, with an invitation code to set their password with.
+// Everything happens in one transaction; with dryRun it is rolled back at the end, so the
+// results show exactly what an import would do, but no codes are handed out. It returns
+// ErrRecordNotFound if the classroom doesn't exist and ErrArchived if it is archived.
+func (m MemberModel) ImportRoster(classId int, entries []*RosterEntry, dryRun bool, actor Actor) ([]*RosterResult, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Keep the classroom from being deleted or archived while its roster is imported.
+	var archived bool
+	err = tx.QueryRowContext(ctx, `SELECT archived_at IS NOT NULL FROM classroom WHERE id = $1 AND deleted_at IS NULL FOR SHARE`, classId).Scan(&archived)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+	if archived {
+		return nil, ErrArchived
+	}
+
+	results := make([]*RosterResult, 0, len(entries))
+	for _, entry := range entries {
+		result, err := m.importEntry(ctx, tx, classId, entry, dryRun, actor)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	if dryRun {
+		return results, nil
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (m MemberModel) importEntry(ctx context.Context, tx *sql.Tx, classId int, entry *RosterEntry, dryRun bool, actor Actor) (*RosterResult, error) {
+	result := &RosterResult{Row: entry.Row, Email: entry.User.Email, Role: entry.Role}
+
+	err := tx.QueryRowContext(ctx, `SELECT id FROM users WHERE email = $1`, entry.User.Email).Scan(&result.UserID)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		if err := insertUser(ctx, tx, entry.User, actor); err != nil {
+			return nil, err
+		}
+		if err := addPermissions(ctx, tx, entry.User.Id, actor, DefaultPermissions...); err != nil {
+			return nil, err
+		}
+		result.UserID = entry.User.Id
+		result.Status = RosterCreated
+
+		if !dryRun {
+			token, err := generateToken(entry.User.Id, invitationTTL, ScopeInvitation)
+			if err != nil {
+				return nil, err
+			}
+			if err := insertToken(ctx, tx, token, actor); err != nil {
+				return nil, err
+			}
+			result.InvitationCode = token.Plaintext
+		}
+	case err != nil:
+		return nil, err
+	}
+
+	var role string
+	err = tx.QueryRowContext(ctx, `SELECT role FROM classroom_members WHERE class_id = $1 AND user_id = $2 FOR UPDATE`, classId, result.UserID).Scan(&role)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		_, err := tx.ExecContext(ctx, `INSERT INTO classroom_members (class_id, user_id, role) VALUES ($1, $2, $3)`, classId, result.UserID, entry.Role)
+		if err != nil {
+			return nil, err
+		}
+
+		after := map[string]any{"user_id": result.UserID, "role": entry.Role}
+		if err := insertAuditEntry(ctx, tx, actor, AuditCreate, EntityMember, classId, nil, after); err != nil {
+			return nil, err
+		}
+
+		if result.Status == "" {
+			result.Status = RosterEnrolled
+		}
+	case err != nil:
+		return nil, err
+	case role != entry.Role:
+		_, err := tx.ExecContext(ctx, `UPDATE classroom_members SET role = $3 WHERE class_id = $1 AND user_id = $2`, classId, result.UserID, entry.Role)
+		if err != nil {
+			return nil, err
+		}
+
+		before := map[string]any{"user_id": result.UserID, "role": role}
+		after := map[string]any{"user_id": result.UserID, "role": entry.Role}
+		if err := insertAuditEntry(ctx, tx, actor, AuditUpdate, EntityMember, classId, before, after); err != nil {
+			return nil, err
+		}
+
+		result.Status = RosterRoleChanged
+	default:
+		result.Status = RosterUnchanged
+	}
+
+	return result, nil
+}
@@ -9,21 +9,39 @@ import (
 
 var (
 	ErrRecordNotFound = errors.New("record not found")
+	ErrEditConflict   = errors.New("edit conflict")
+	ErrArchived       = errors.New("archived")
 )
 
 type Models struct {
-	Classrooms  ClassroomModel
-	Tasks       TaskModel
-	Users       UserModel
-	Tokens      TokenModel
-	Permissions PermissionModel
+	Classrooms    ClassroomModel
+	Tasks         TaskModel
+	Users         UserModel
+	Tokens        TokenModel
+	Permissions   PermissionModel
+	Search        SearchModel
+	Trash         TrashModel
+	Audit         AuditModel
+	Webhooks      WebhookModel
+	Notifications NotificationModel
+	Jobs          JobModel
+	Reminders     ReminderModel
+	Members       MemberModel
+	Batch         BatchModel
+	Templates     TemplateModel
+	Terms         TermModel
+	Clones        CloneModel
+	Rooms         RoomModel
+	Sessions      SessionModel
+	Attendance    AttendanceModel
+	Quizzes       QuizModel
 }
 
 func NewModels(db *sql.DB) Models {
 	infoLog := log.New(os.Stdout, "INFO\t", log.Ldate|log.Ltime)
 	errorLog := log.New(os.Stderr, "ERROR\t", log.Ldate|log.Ltime|log.Lshortfile)
 
-	return Models{
+	models := Models{
 		Classrooms: ClassroomModel{
 			DB:       db,
 			InfoLog:  infoLog,
@@ -49,5 +67,95 @@ func NewModels(db *sql.DB) Models {
 			InfoLog:  infoLog,
 			ErrorLog: errorLog,
 		},
+		Search: SearchModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		},
+		Trash: TrashModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		},
+		Audit: AuditModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		},
+		Webhooks: WebhookModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		},
+		Notifications: NotificationModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		},
+		Jobs: JobModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		},
+		Reminders: ReminderModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		},
+		Members: MemberModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		},
+		Terms: TermModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		},
+		Rooms: RoomModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		},
+		Sessions: SessionModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		},
+		Attendance: AttendanceModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		},
+		Quizzes: QuizModel{
+			DB:       db,
+			InfoLog:  infoLog,
+			ErrorLog: errorLog,
+		},
 	}
+
+	models.Batch = BatchModel{
+		DB:         db,
+		InfoLog:    infoLog,
+		ErrorLog:   errorLog,
+		Classrooms: models.Classrooms,
+		Tasks:      models.Tasks,
+	}
+
+	models.Templates = TemplateModel{
+		DB:       db,
+		InfoLog:  infoLog,
+		ErrorLog: errorLog,
+		Tasks:    models.Tasks,
+	}
+
+	models.Clones = CloneModel{
+		DB:         db,
+		InfoLog:    infoLog,
+		ErrorLog:   errorLog,
+		Classrooms: models.Classrooms,
+		Tasks:      models.Tasks,
+	}
+
+	return models
 }
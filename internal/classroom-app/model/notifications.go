@@ -0,0 +1,311 @@
+package model
+
+import (
+	"FinalProject/internal/classroom-app/validator"
+	"context"
+	"database/sql"
+	"log"
+	"time"
+)
+
+// EventTaskDueSoon is the event of a reminder that a task is due soon.
+const EventTaskDueSoon = "task.due_soon"
+
+// NotificationEvents are the events users are notified about. Every one of them can be muted.
+var NotificationEvents = []string{
+	EventClassroomCreated,
+	EventTaskCreated,
+	EventTaskUpdated,
+	EventTaskDueSoon,
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx.
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+type Notification struct {
+	Id         int64      `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	Event      string     `json:"event"`
+	EntityType string     `json:"entity_type"`
+	EntityID   int        `json:"entity_id"`
+	ActorID    *int       `json:"actor_id"`
+	Title      string     `json:"title"`
+	ReadAt     *time.Time `json:"read_at"`
+}
+
+type NotificationModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+}
+
+// Notify creates the notification of a classroom or task for every activated member of the
+// classroom, or of the classrooms of the task, who has the given permission, except for the
+// actor who caused it and the users who muted the event.
+func (m NotificationModel) Notify(notification *Notification, permission string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return insertNotifications(ctx, m.DB, notification, recipients{permission: permission})
+}
+
+// recipients are the members of the classrooms of a notification who get it.
+type recipients struct {
+	// permission is the permission they need.
+	permission string
+	// role is the role they need in the classroom, any role if empty.
+	role string
+	// unsubmitted leaves out the users who submitted the task, e.g. a quiz attempt.
+	unsubmitted bool
+}
+
+// insertNotifications does the work of Notify for the recipients using db, which may be a
+// transaction.
+func insertNotifications(ctx context.Context, db execer, notification *Notification, to recipients) error {
+	query := `
+		INSERT INTO notifications (user_id, event, entity_type, entity_id, actor_id, title)
+		SELECT u.id, $1, $2, $3, $4, $5
+		FROM users u
+			INNER JOIN users_permissions up ON up.user_id = u.id
+			INNER JOIN permissions p ON p.id = up.permission_id
+		WHERE p.code = $6
+			AND u.activated
+			AND u.id IS DISTINCT FROM $4
+			AND EXISTS (
+				SELECT 1 FROM classroom_members cm
+				WHERE cm.user_id = u.id
+					AND ($7 = '' OR cm.role = $7)
+					AND (
+						($2 = 'classroom' AND cm.class_id = $3)
+						OR ($2 = 'task' AND cm.class_id IN (SELECT class_id FROM classroom_task WHERE task_id = $3))
+					)
+			)
+			AND NOT ($8 AND EXISTS (
+				SELECT 1 FROM quiz_attempts qa
+				WHERE qa.task_id = $3 AND qa.user_id = u.id AND qa.submitted_at IS NOT NULL
+			))
+			AND NOT EXISTS (
+				SELECT 1 FROM notification_mutes nm
+				WHERE nm.user_id = u.id AND nm.event = $1
+			)
+		`
+
+	args := []any{
+		notification.Event,
+		notification.EntityType,
+		notification.EntityID,
+		notification.ActorID,
+		notification.Title,
+		to.permission,
+		to.role,
+		to.unsubmitted,
+	}
+
+	_, err := db.ExecContext(ctx, query, args...)
+	return err
+}
+
+// GetAllForUser returns the notifications of the user, newest first. With unreadOnly only the
+// ones not yet read are returned.
+func (m NotificationModel) GetAllForUser(userID int, unreadOnly bool, filters Filters) ([]*Notification, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), id, created_at, event, entity_type, entity_id, actor_id, title, read_at
+		FROM notifications
+		WHERE user_id = $1 AND (read_at IS NULL OR NOT $2)
+		ORDER BY id DESC
+		LIMIT $3 OFFSET $4
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, unreadOnly, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	totalRecords := 0
+
+	notifications := []*Notification{}
+	for rows.Next() {
+		var notification Notification
+		err := rows.Scan(
+			&totalRecords,
+			&notification.Id,
+			&notification.CreatedAt,
+			&notification.Event,
+			&notification.EntityType,
+			&notification.EntityID,
+			&notification.ActorID,
+			&notification.Title,
+			&notification.ReadAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		notifications = append(notifications, &notification)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return notifications, metadata, nil
+}
+
+// CountUnread returns the number of notifications the user hasn't read yet.
+func (m NotificationModel) CountUnread(userID int) (int, error) {
+	query := `
+		SELECT count(*) FROM notifications
+		WHERE user_id = $1 AND read_at IS NULL
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var count int
+	err := m.DB.QueryRowContext(ctx, query, userID).Scan(&count)
+	return count, err
+}
+
+// MarkRead marks a notification of the user as read. Marking it again keeps the time it was
+// first read. It returns ErrRecordNotFound if the user has no such notification.
+func (m NotificationModel) MarkRead(userID int, id int64) error {
+	query := `
+		UPDATE notifications
+		SET read_at = COALESCE(read_at, now())
+		WHERE id = $1 AND user_id = $2
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id, userID)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// MarkAllRead marks all notifications of the user as read and returns how many were unread.
+func (m NotificationModel) MarkAllRead(userID int) (int64, error) {
+	query := `
+		UPDATE notifications
+		SET read_at = now()
+		WHERE user_id = $1 AND read_at IS NULL
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
+
+// GetPreferences returns for every notification event whether the user gets notified about it.
+func (m NotificationModel) GetPreferences(userID int) (map[string]bool, error) {
+	query := `
+		SELECT event FROM notification_mutes
+		WHERE user_id = $1
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	preferences := make(map[string]bool)
+	for _, event := range NotificationEvents {
+		preferences[event] = true
+	}
+
+	for rows.Next() {
+		var event string
+		if err := rows.Scan(&event); err != nil {
+			return nil, err
+		}
+		preferences[event] = false
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return preferences, nil
+}
+
+// SetPreferences mutes the events set to false and unmutes the ones set to true. Events that
+// aren't in preferences keep their current setting.
+func (m NotificationModel) SetPreferences(userID int, preferences map[string]bool) error {
+	mute := `
+		INSERT INTO notification_mutes (user_id, event)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+		`
+	unmute := `
+		DELETE FROM notification_mutes
+		WHERE user_id = $1 AND event = $2
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for event, enabled := range preferences {
+		query := mute
+		if enabled {
+			query = unmute
+		}
+
+		if _, err := tx.ExecContext(ctx, query, userID, event); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func ValidateNotificationPreferences(v *validator.Validator, preferences map[string]bool) {
+	v.Check(len(preferences) > 0, "preferences", "must contain at least one event")
+	for event := range preferences {
+		v.Check(validator.In(event, NotificationEvents...), "preferences", "unknown event "+event)
+	}
+}
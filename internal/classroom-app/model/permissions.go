@@ -9,6 +9,10 @@ import (
 	"github.com/lib/pq"
 )
 
+// DefaultPermissions are the permissions every new user gets, whether they register or are
+// imported with a roster.
+var DefaultPermissions = []string{"class:read"}
+
 type Permissions []string
 
 func (p Permissions) Include(code string) bool {
@@ -70,15 +74,35 @@ func (m PermissionModel) GetAllForUser(userID int) (Permissions, error) {
 }
 
 // AddForUser adds the provided codes for a specific user.
-func (m PermissionModel) AddForUser(userID int, codes ...string) error {
+func (m PermissionModel) AddForUser(userID int, actor Actor, codes ...string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = addPermissions(ctx, tx, userID, actor, codes...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// addPermissions does the work of AddForUser in tx.
+func addPermissions(ctx context.Context, tx *sql.Tx, userID int, actor Actor, codes ...string) error {
 	query := `
 		INSERT INTO users_permissions
 		SELECT $1, permissions.id FROM permissions WHERE permissions.code = ANY($2)
 		`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	_, err := tx.ExecContext(ctx, query, userID, pq.Array(codes))
+	if err != nil {
+		return err
+	}
 
-	_, err := m.DB.ExecContext(ctx, query, userID, pq.Array(codes))
-	return err
+	after := map[string]any{"codes": codes}
+	return insertAuditEntry(ctx, tx, actor, AuditCreate, EntityPermission, userID, nil, after)
 }
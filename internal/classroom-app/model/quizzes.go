@@ -0,0 +1,985 @@
+package model
+
+import (
+	"FinalProject/internal/classroom-app/validator"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Kinds of quiz questions.
+const (
+	// QuestionSingle questions have one correct option.
+	QuestionSingle = "single"
+	// QuestionMulti questions are answered with every correct option and nothing else.
+	QuestionMulti = "multi"
+	// QuestionNumeric questions are answered with a number within the tolerance of the key.
+	QuestionNumeric = "numeric"
+	// QuestionText questions are answered with a text that matches one of the keys.
+	QuestionText = "text"
+)
+
+// How the answer to a text question is matched against its keys.
+const (
+	MatchExact = "exact"
+	MatchRegex = "regex"
+)
+
+// submitGrace is how long after its deadline an attempt can still be submitted, for answers
+// that were sent in time but arrive late.
+const submitGrace = 30 * time.Second
+
+var (
+	// ErrQuizClosed is returned when an attempt is started or submitted after the quiz closed.
+	ErrQuizClosed = errors.New("quiz closed")
+	// ErrAttemptLimit is returned when a user has used up the attempts of a quiz.
+	ErrAttemptLimit = errors.New("attempt limit reached")
+	// ErrAttemptOver is returned when an attempt is submitted twice or after its time limit.
+	ErrAttemptOver = errors.New("attempt over")
+	// ErrQuizAttempted is returned when the questions of a quiz that has attempts are changed.
+	ErrQuizAttempted = errors.New("quiz attempted")
+)
+
+// Quiz turns a task into a quiz. Students answer its questions in attempts that are graded
+// automatically. TimeLimitMinutes and MaxAttempts are unlimited if nil, and a quiz without
+// ClosesAt never closes.
+type Quiz struct {
+	TaskId           int         `json:"taskId"`
+	TimeLimitMinutes *int        `json:"timeLimitMinutes"`
+	MaxAttempts      *int        `json:"maxAttempts"`
+	ShuffleQuestions bool        `json:"shuffleQuestions"`
+	ShuffleOptions   bool        `json:"shuffleOptions"`
+	ClosesAt         *time.Time  `json:"closesAt"`
+	MaxScore         int         `json:"maxScore"`
+	Questions        []*Question `json:"questions"`
+	CreatedAt        time.Time   `json:"createdAt"`
+	UpdatedAt        time.Time   `json:"updatedAt"`
+	Version          int         `json:"version"`
+}
+
+// QuizOption is an option of a single or multi question. Its Id is its position in the
+// question as the teacher wrote it, and stays the same when options are shuffled.
+type QuizOption struct {
+	Id   int    `json:"id"`
+	Text string `json:"text"`
+}
+
+// Question is a question of a quiz. Key is only loaded for those allowed to see it.
+type Question struct {
+	Id      int          `json:"id"`
+	Kind    string       `json:"kind"`
+	Prompt  string       `json:"prompt"`
+	Points  int          `json:"points"`
+	Options []QuizOption `json:"options,omitempty"`
+	Key     *AnswerKey   `json:"key,omitempty"`
+}
+
+// AnswerKey is the correct answer to a question: the ids of the correct Options of single and
+// multi questions, Number give or take Tolerance for numeric questions, and Texts, matched
+// exactly or as regular expressions, for text questions. Texts are matched case-insensitively
+// unless CaseSensitive is set, and surrounding spaces of answers are ignored.
+type AnswerKey struct {
+	Options       []int    `json:"options,omitempty"`
+	Number        *float64 `json:"number,omitempty"`
+	Tolerance     float64  `json:"tolerance,omitempty"`
+	Texts         []string `json:"texts,omitempty"`
+	Match         string   `json:"match,omitempty"`
+	CaseSensitive bool     `json:"caseSensitive,omitempty"`
+}
+
+// QuizAttempt is one go of a user at a quiz. Its Questions are in the order the user sees them.
+// Answers are keyed by question id. Correct is only set once the attempt is submitted and the
+// keys may be seen.
+type QuizAttempt struct {
+	Id          int                     `json:"id"`
+	TaskId      int                     `json:"taskId"`
+	UserID      int                     `json:"userId"`
+	Number      int                     `json:"number"`
+	StartedAt   time.Time               `json:"startedAt"`
+	DeadlineAt  *time.Time              `json:"deadlineAt"`
+	SubmittedAt *time.Time              `json:"submittedAt"`
+	Answers     map[int]json.RawMessage `json:"answers"`
+	Score       *int                    `json:"score"`
+	MaxScore    int                     `json:"maxScore"`
+	Questions   []*Question             `json:"questions"`
+	Correct     map[int]bool            `json:"correct,omitempty"`
+	seed        int64
+}
+
+// QuizResult is the best submitted score of a user at a quiz, nil if they submitted nothing.
+type QuizResult struct {
+	UserID    int    `json:"userId"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	Email     string `json:"email"`
+	Attempts  int    `json:"attempts"`
+	BestScore *int   `json:"bestScore"`
+	MaxScore  int    `json:"maxScore"`
+}
+
+type QuizModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+}
+
+// Closed reports whether the quiz has closed. Students can see the answer keys from then on.
+func (q *Quiz) Closed() bool {
+	return q.ClosesAt != nil && !time.Now().Before(*q.ClosesAt)
+}
+
+// Get returns the quiz of the task, with the answer keys of its questions only if withKeys is
+// set. It returns ErrRecordNotFound if the task has no quiz or is deleted.
+func (m QuizModel) Get(taskId int, withKeys bool) (*Quiz, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	quiz, err := getQuiz(ctx, tx, taskId, withKeys, false)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return quiz, nil
+}
+
+// Save creates or updates the quiz of the task. The questions are only replaced if
+// replaceQuestions is set, which fails with ErrQuizAttempted once the quiz has attempts. It
+// returns ErrRecordNotFound if the task doesn't exist or is deleted and ErrArchived if it is
+// in an archived classroom. On success quiz is the saved quiz, with keys.
+func (m QuizModel) Save(quiz *Quiz, replaceQuestions bool, actor Actor) error {
+	query := `
+		INSERT INTO quizzes (task_id, time_limit_minutes, max_attempts, shuffle_questions, shuffle_options, closes_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (task_id) DO UPDATE
+		SET time_limit_minutes = EXCLUDED.time_limit_minutes, max_attempts = EXCLUDED.max_attempts,
+			shuffle_questions = EXCLUDED.shuffle_questions, shuffle_options = EXCLUDED.shuffle_options,
+			closes_at = EXCLUDED.closes_at, updated_at = now(), version = quizzes.version + 1
+		`
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	err = tx.QueryRowContext(ctx, `SELECT true FROM task WHERE id = $1 AND deleted_at IS NULL FOR SHARE`, quiz.TaskId).Scan(&exists)
+	if err != nil {
+		return notFound(err)
+	}
+	if err = checkNotArchived(ctx, tx, quiz.TaskId); err != nil {
+		return err
+	}
+
+	before, err := getQuiz(ctx, tx, quiz.TaskId, true, true)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	if before == nil && !replaceQuestions {
+		return FieldErrors{"questions": "must be provided"}
+	}
+
+	args := []any{quiz.TaskId, quiz.TimeLimitMinutes, quiz.MaxAttempts, quiz.ShuffleQuestions, quiz.ShuffleOptions, quiz.ClosesAt}
+	if _, err = tx.ExecContext(ctx, query, args...); err != nil {
+		return err
+	}
+
+	if replaceQuestions {
+		if err = replaceQuizQuestions(ctx, tx, quiz.TaskId, quiz.Questions); err != nil {
+			return err
+		}
+	}
+
+	saved, err := getQuiz(ctx, tx, quiz.TaskId, true, false)
+	if err != nil {
+		return err
+	}
+
+	if before == nil {
+		err = insertAuditEntry(ctx, tx, actor, AuditCreate, EntityQuiz, quiz.TaskId, nil, saved)
+	} else {
+		err = insertAuditEntry(ctx, tx, actor, AuditUpdate, EntityQuiz, quiz.TaskId, before, saved)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	*quiz = *saved
+	return nil
+}
+
+// Delete removes the quiz of the task with its questions and attempts, the task stays as a
+// plain task. It returns ErrRecordNotFound if the task has no quiz.
+func (m QuizModel) Delete(taskId int, actor Actor) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := getQuiz(ctx, tx, taskId, true, true)
+	if err != nil {
+		return notFound(err)
+	}
+	if err = checkNotArchived(ctx, tx, taskId); err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM quizzes WHERE task_id = $1`, taskId); err != nil {
+		return err
+	}
+
+	err = insertAuditEntry(ctx, tx, actor, AuditDelete, EntityQuiz, taskId, before, nil)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// StartAttempt starts an attempt of the user at the quiz of the task, or returns the attempt
+// they haven't submitted yet if its time isn't up. The attempt ends at its time limit or when
+// the quiz closes, whichever is first. It returns ErrRecordNotFound if the task has no quiz,
+// ErrNotStudent if the user isn't a student of one of its classrooms, ErrQuizClosed if it has
+// closed, ErrArchived if it is in an archived classroom and ErrAttemptLimit if the user has no
+// attempts left.
+func (m QuizModel) StartAttempt(taskId, userID int) (*QuizAttempt, error) {
+	query := `
+		INSERT INTO quiz_attempts (task_id, user_id, number, seed, deadline_at, max_score)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, started_at
+		`
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Locking the quiz keeps two attempts of the same user from starting at once.
+	quiz, err := getQuiz(ctx, tx, taskId, false, true)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	if err = checkTaskStudent(ctx, tx, taskId, userID); err != nil {
+		return nil, err
+	}
+	if quiz.Closed() {
+		return nil, ErrQuizClosed
+	}
+	if err = checkNotArchived(ctx, tx, taskId); err != nil {
+		return nil, err
+	}
+
+	var open sql.NullInt64
+	var count int
+	err = tx.QueryRowContext(ctx, `
+		SELECT max(id) FILTER (
+			WHERE submitted_at IS NULL AND (deadline_at IS NULL OR deadline_at + make_interval(secs => $3) > now())
+		), count(*)
+		FROM quiz_attempts
+		WHERE task_id = $1 AND user_id = $2
+		`, taskId, userID, submitGrace.Seconds()).Scan(&open, &count)
+	if err != nil {
+		return nil, err
+	}
+
+	if open.Valid {
+		attempt, err := getAttempt(ctx, tx, int(open.Int64))
+		if err != nil {
+			return nil, err
+		}
+		if err = tx.Commit(); err != nil {
+			return nil, err
+		}
+		attempt.arrange(quiz)
+		return attempt, nil
+	}
+
+	if quiz.MaxAttempts != nil && count >= *quiz.MaxAttempts {
+		return nil, ErrAttemptLimit
+	}
+
+	attempt := &QuizAttempt{
+		TaskId:   taskId,
+		UserID:   userID,
+		Number:   count + 1,
+		Answers:  map[int]json.RawMessage{},
+		MaxScore: quiz.MaxScore,
+		seed:     rand.Int63(),
+	}
+
+	if quiz.TimeLimitMinutes != nil {
+		deadline := time.Now().Add(time.Duration(*quiz.TimeLimitMinutes) * time.Minute)
+		attempt.DeadlineAt = &deadline
+	}
+	if quiz.ClosesAt != nil && (attempt.DeadlineAt == nil || quiz.ClosesAt.Before(*attempt.DeadlineAt)) {
+		attempt.DeadlineAt = quiz.ClosesAt
+	}
+
+	args := []any{taskId, userID, attempt.Number, attempt.seed, attempt.DeadlineAt, attempt.MaxScore}
+	if err = tx.QueryRowContext(ctx, query, args...).Scan(&attempt.Id, &attempt.StartedAt); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	attempt.arrange(quiz)
+	return attempt, nil
+}
+
+// GetAttempt returns the attempt with its questions, with the answer keys and which answers
+// were correct only if withKeys is set.
+func (m QuizModel) GetAttempt(id int, withKeys bool) (*QuizAttempt, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	attempt, err := getAttempt(ctx, tx, id)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	quiz, err := getQuiz(ctx, tx, attempt.TaskId, true, false)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	if withKeys && attempt.SubmittedAt != nil {
+		attempt.Correct = make(map[int]bool, len(quiz.Questions))
+		for _, question := range quiz.Questions {
+			correct, _ := question.grade(attempt.Answers[question.Id])
+			attempt.Correct[question.Id] = correct
+		}
+	}
+	if !withKeys {
+		for _, question := range quiz.Questions {
+			question.Key = nil
+		}
+	}
+
+	attempt.arrange(quiz)
+	return attempt, nil
+}
+
+// SubmitAttempt grades the answers of the user's attempt and records them with its score.
+// Questions without an answer score nothing. It returns ErrRecordNotFound if the attempt isn't
+// the user's, ErrNotStudent if they are no longer a student of a classroom of the task,
+// ErrAttemptOver if it was submitted before or its time is up, ErrQuizClosed if
+// the quiz has closed and FieldErrors if an answer isn't one to its question.
+func (m QuizModel) SubmitAttempt(id, userID int, answers map[int]json.RawMessage) (*QuizAttempt, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Lock the attempt before reading it so it can't be submitted twice at once.
+	if _, err = tx.ExecContext(ctx, `SELECT id FROM quiz_attempts WHERE id = $1 FOR UPDATE`, id); err != nil {
+		return nil, err
+	}
+	attempt, err := getAttempt(ctx, tx, id)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	if attempt.UserID != userID {
+		return nil, ErrRecordNotFound
+	}
+	if attempt.SubmittedAt != nil {
+		return nil, ErrAttemptOver
+	}
+	if err = checkTaskStudent(ctx, tx, attempt.TaskId, userID); err != nil {
+		return nil, err
+	}
+
+	quiz, err := getQuiz(ctx, tx, attempt.TaskId, true, false)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	now := time.Now()
+	if quiz.ClosesAt != nil && now.After(quiz.ClosesAt.Add(submitGrace)) {
+		return nil, ErrQuizClosed
+	}
+	if attempt.DeadlineAt != nil && now.After(attempt.DeadlineAt.Add(submitGrace)) {
+		return nil, ErrAttemptOver
+	}
+
+	questions := make(map[int]*Question, len(quiz.Questions))
+	for _, question := range quiz.Questions {
+		questions[question.Id] = question
+	}
+
+	score := 0
+	for questionId, answer := range answers {
+		question, ok := questions[questionId]
+		if !ok {
+			return nil, FieldErrors{"answers": fmt.Sprintf("question %d is not a question of the quiz", questionId)}
+		}
+
+		correct, err := question.grade(answer)
+		if err != nil {
+			return nil, FieldErrors{"answers": fmt.Sprintf("question %d: %s", questionId, err)}
+		}
+		if correct {
+			score += question.Points
+		}
+	}
+
+	js, err := json.Marshal(answers)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRowContext(ctx, `
+		UPDATE quiz_attempts
+		SET answers = $2, score = $3, max_score = $4, submitted_at = now()
+		WHERE id = $1
+		RETURNING submitted_at
+		`, id, string(js), score, quiz.MaxScore).Scan(&attempt.SubmittedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	attempt.Answers = answers
+	attempt.Score = &score
+	attempt.MaxScore = quiz.MaxScore
+	for _, question := range quiz.Questions {
+		question.Key = nil
+	}
+	attempt.arrange(quiz)
+	return attempt, nil
+}
+
+// GetAttempts returns the attempts of the user at the quiz of the task, oldest first, without
+// their questions.
+func (m QuizModel) GetAttempts(taskId, userID int) ([]*QuizAttempt, error) {
+	query := `
+		SELECT id, task_id, user_id, number, seed, started_at, deadline_at, submitted_at, answers, score, max_score
+		FROM quiz_attempts
+		WHERE task_id = $1 AND user_id = $2
+		ORDER BY number
+		`
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, taskId, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	attempts := []*QuizAttempt{}
+	for rows.Next() {
+		attempt, err := scanAttempt(rows)
+		if err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, attempt)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return attempts, nil
+}
+
+// Results returns the best submitted score of every student of the classrooms of the task who
+// attempted its quiz, ordered by name.
+func (m QuizModel) Results(taskId int) ([]*QuizResult, error) {
+	query := `
+		SELECT u.id, u.first_name, u.last_name, u.email, count(*), max(a.score), max(a.max_score)
+		FROM quiz_attempts a
+			INNER JOIN users u ON u.id = a.user_id
+		WHERE a.task_id = $1
+			AND EXISTS (
+				SELECT 1 FROM classroom_task ct
+					INNER JOIN classroom_members cm ON cm.class_id = ct.class_id
+				WHERE ct.task_id = a.task_id AND cm.user_id = a.user_id AND cm.role = 'student'
+			)
+		GROUP BY u.id
+		ORDER BY u.last_name, u.first_name, u.id
+		`
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, taskId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	results := []*QuizResult{}
+	for rows.Next() {
+		var result QuizResult
+		err := rows.Scan(
+			&result.UserID,
+			&result.FirstName,
+			&result.LastName,
+			&result.Email,
+			&result.Attempts,
+			&result.BestScore,
+			&result.MaxScore,
+		)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, &result)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// checkTaskStudent returns ErrNotStudent unless the user is a student of a classroom of the
+// task that isn't deleted, like isStudent does for a single classroom.
+func checkTaskStudent(ctx context.Context, tx *sql.Tx, taskId, userID int) error {
+	var student bool
+	err := tx.QueryRowContext(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM classroom_task ct
+				INNER JOIN classroom c ON c.id = ct.class_id AND c.deleted_at IS NULL
+				INNER JOIN classroom_members cm ON cm.class_id = ct.class_id
+			WHERE ct.task_id = $1 AND cm.user_id = $2 AND cm.role = 'student'
+		)
+		`, taskId, userID).Scan(&student)
+	if err != nil {
+		return err
+	}
+	if !student {
+		return ErrNotStudent
+	}
+	return nil
+}
+
+// getQuiz reads the quiz of the task that isn't deleted with its questions in tx, locking the
+// quiz until tx ends if forUpdate is set. The keys of the questions are only read if withKeys
+// is set.
+func getQuiz(ctx context.Context, tx *sql.Tx, taskId int, withKeys, forUpdate bool) (*Quiz, error) {
+	query := `
+		SELECT q.task_id, q.time_limit_minutes, q.max_attempts, q.shuffle_questions, q.shuffle_options,
+			q.closes_at, q.created_at, q.updated_at, q.version
+		FROM quizzes q
+			INNER JOIN task t ON t.id = q.task_id AND t.deleted_at IS NULL
+		WHERE q.task_id = $1
+		`
+	if forUpdate {
+		query += ` FOR UPDATE OF q`
+	}
+
+	var quiz Quiz
+	err := tx.QueryRowContext(ctx, query, taskId).Scan(
+		&quiz.TaskId,
+		&quiz.TimeLimitMinutes,
+		&quiz.MaxAttempts,
+		&quiz.ShuffleQuestions,
+		&quiz.ShuffleOptions,
+		&quiz.ClosesAt,
+		&quiz.CreatedAt,
+		&quiz.UpdatedAt,
+		&quiz.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	quiz.Questions, err = getQuestions(ctx, tx, taskId, withKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, question := range quiz.Questions {
+		quiz.MaxScore += question.Points
+	}
+	return &quiz, nil
+}
+
+// getQuestions reads the questions of a quiz in tx in the order the teacher wrote them. The key
+// columns are only selected if withKeys is set, so keys can't leak into other responses.
+func getQuestions(ctx context.Context, tx *sql.Tx, taskId int, withKeys bool) ([]*Question, error) {
+	columns := `id, kind, prompt, points, options`
+	if withKeys {
+		columns += `, key_options, key_number, key_tolerance, key_texts, key_match, key_case_sensitive`
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT `+columns+` FROM quiz_questions WHERE task_id = $1 ORDER BY position`, taskId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	questions := []*Question{}
+	for rows.Next() {
+		var question Question
+		var options []string
+		dest := []any{&question.Id, &question.Kind, &question.Prompt, &question.Points, pq.Array(&options)}
+
+		var key AnswerKey
+		var keyOptions []int64
+		if withKeys {
+			dest = append(dest, pq.Array(&keyOptions), &key.Number, &key.Tolerance, pq.Array(&key.Texts), &key.Match, &key.CaseSensitive)
+		}
+
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		for i, option := range options {
+			question.Options = append(question.Options, QuizOption{Id: i, Text: option})
+		}
+		if withKeys {
+			for _, option := range keyOptions {
+				key.Options = append(key.Options, int(option))
+			}
+			question.Key = &key
+		}
+		questions = append(questions, &question)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return questions, rows.Close()
+}
+
+// replaceQuizQuestions replaces the questions of a quiz that has no attempts in tx.
+func replaceQuizQuestions(ctx context.Context, tx *sql.Tx, taskId int, questions []*Question) error {
+	var attempted bool
+	err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM quiz_attempts WHERE task_id = $1)`, taskId).Scan(&attempted)
+	if err != nil {
+		return err
+	}
+	if attempted {
+		return ErrQuizAttempted
+	}
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM quiz_questions WHERE task_id = $1`, taskId); err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO quiz_questions (task_id, position, kind, prompt, points, options, key_options,
+			key_number, key_tolerance, key_texts, key_match, key_case_sensitive)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		`
+	for i, question := range questions {
+		options := make([]string, len(question.Options))
+		for j, option := range question.Options {
+			options[j] = option.Text
+		}
+
+		key := question.Key
+		if key.Match == "" {
+			key.Match = MatchExact
+		}
+
+		// pq writes nil slices as NULL, the columns want empty arrays.
+		keyOptions := make([]int64, len(key.Options))
+		for j, option := range key.Options {
+			keyOptions[j] = int64(option)
+		}
+		keyTexts := key.Texts
+		if keyTexts == nil {
+			keyTexts = []string{}
+		}
+
+		args := []any{
+			taskId,
+			i,
+			question.Kind,
+			question.Prompt,
+			question.Points,
+			pq.Array(options),
+			pq.Array(keyOptions),
+			key.Number,
+			key.Tolerance,
+			pq.Array(keyTexts),
+			key.Match,
+			key.CaseSensitive,
+		}
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getAttempt(ctx context.Context, tx *sql.Tx, id int) (*QuizAttempt, error) {
+	query := `
+		SELECT id, task_id, user_id, number, seed, started_at, deadline_at, submitted_at, answers, score, max_score
+		FROM quiz_attempts
+		WHERE id = $1
+		`
+	return scanAttempt(tx.QueryRowContext(ctx, query, id))
+}
+
+func scanAttempt(row rowScanner) (*QuizAttempt, error) {
+	var attempt QuizAttempt
+	var answers []byte
+	err := row.Scan(
+		&attempt.Id,
+		&attempt.TaskId,
+		&attempt.UserID,
+		&attempt.Number,
+		&attempt.seed,
+		&attempt.StartedAt,
+		&attempt.DeadlineAt,
+		&attempt.SubmittedAt,
+		&answers,
+		&attempt.Score,
+		&attempt.MaxScore,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = json.Unmarshal(answers, &attempt.Answers); err != nil {
+		return nil, err
+	}
+	return &attempt, nil
+}
+
+// arrange sets the questions of the attempt to the ones of the quiz, shuffled by the seed of
+// the attempt if the quiz shuffles them, so an attempt always shows the same order.
+func (a *QuizAttempt) arrange(quiz *Quiz) {
+	random := rand.New(rand.NewSource(a.seed))
+
+	questions := make([]*Question, len(quiz.Questions))
+	for i, question := range quiz.Questions {
+		arranged := *question
+		arranged.Options = append([]QuizOption(nil), question.Options...)
+		if quiz.ShuffleOptions {
+			random.Shuffle(len(arranged.Options), func(i, j int) {
+				arranged.Options[i], arranged.Options[j] = arranged.Options[j], arranged.Options[i]
+			})
+		}
+		questions[i] = &arranged
+	}
+
+	if quiz.ShuffleQuestions {
+		random.Shuffle(len(questions), func(i, j int) {
+			questions[i], questions[j] = questions[j], questions[i]
+		})
+	}
+	a.Questions = questions
+}
+
+// grade reports whether answer is a correct answer to the question. It returns an error if the
+// answer has the wrong type for the question, an option id that doesn't exist or isn't valid.
+// An empty answer is not correct.
+func (q *Question) grade(answer json.RawMessage) (bool, error) {
+	if len(answer) == 0 || string(answer) == "null" {
+		return false, nil
+	}
+
+	key := q.Key
+	switch q.Kind {
+	case QuestionSingle:
+		var option int
+		if err := json.Unmarshal(answer, &option); err != nil || option < 0 || option >= len(q.Options) {
+			return false, errors.New("must be the id of an option")
+		}
+		return len(key.Options) == 1 && key.Options[0] == option, nil
+
+	case QuestionMulti:
+		var options []int
+		if err := json.Unmarshal(answer, &options); err != nil {
+			return false, errors.New("must be a list of option ids")
+		}
+		chosen := make(map[int]bool, len(options))
+		for _, option := range options {
+			if option < 0 || option >= len(q.Options) || chosen[option] {
+				return false, errors.New("must be a list of distinct option ids")
+			}
+			chosen[option] = true
+		}
+		if len(chosen) != len(key.Options) {
+			return false, nil
+		}
+		for _, option := range key.Options {
+			if !chosen[option] {
+				return false, nil
+			}
+		}
+		return true, nil
+
+	case QuestionNumeric:
+		var number float64
+		if err := json.Unmarshal(answer, &number); err != nil {
+			return false, errors.New("must be a number")
+		}
+		// Allow for the rounding of decimal fractions like 0.1.
+		return key.Number != nil && math.Abs(number-*key.Number) <= key.Tolerance+1e-9, nil
+
+	case QuestionText:
+		var text string
+		if err := json.Unmarshal(answer, &text); err != nil {
+			return false, errors.New("must be a text")
+		}
+		text = strings.TrimSpace(text)
+		for _, accepted := range key.Texts {
+			if key.matches(accepted, text) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return false, nil
+}
+
+// matches reports whether text matches the accepted answer of a text question.
+func (k *AnswerKey) matches(accepted, text string) bool {
+	if k.Match == MatchRegex {
+		re, err := compileAnswer(accepted, k.CaseSensitive)
+		return err == nil && re.MatchString(text)
+	}
+	if k.CaseSensitive {
+		return accepted == text
+	}
+	return strings.EqualFold(accepted, text)
+}
+
+// compileAnswer compiles a regular expression an answer has to match as a whole.
+func compileAnswer(expr string, caseSensitive bool) (*regexp.Regexp, error) {
+	if !caseSensitive {
+		expr = "(?i)" + expr
+	}
+	return regexp.Compile(`^(?:` + expr + `)$`)
+}
+
+// Limits of a quiz.
+const (
+	// maxTimeLimitMinutes is a day; longer limits would overflow the deadline of an attempt.
+	maxTimeLimitMinutes = 1440
+	maxQuizQuestions    = 200
+	maxQuestionOptions  = 20
+	maxQuestionTexts    = 20
+	maxPromptBytes      = 2000
+	maxOptionBytes      = 500
+	maxKeyTextBytes     = 500
+)
+
+func ValidateQuiz(v *validator.Validator, quiz *Quiz, withQuestions bool) {
+	v.Check(quiz.TimeLimitMinutes == nil || *quiz.TimeLimitMinutes > 0, "timeLimitMinutes", "must be positive")
+	v.Check(quiz.TimeLimitMinutes == nil || *quiz.TimeLimitMinutes <= maxTimeLimitMinutes, "timeLimitMinutes", fmt.Sprintf("must not be more than %d", maxTimeLimitMinutes))
+	v.Check(quiz.MaxAttempts == nil || *quiz.MaxAttempts > 0, "maxAttempts", "must be positive")
+
+	if !withQuestions {
+		return
+	}
+
+	v.Check(len(quiz.Questions) > 0, "questions", "must be provided")
+	v.Check(len(quiz.Questions) <= maxQuizQuestions, "questions", fmt.Sprintf("must not have more than %d questions", maxQuizQuestions))
+
+	for i, question := range quiz.Questions {
+		qv := validator.New()
+		ValidateQuestion(qv, question)
+		for key, message := range qv.Errors {
+			v.AddError(fmt.Sprintf("questions[%d].%s", i, key), message)
+		}
+	}
+}
+
+func ValidateQuestion(v *validator.Validator, question *Question) {
+	v.Check(validator.In(question.Kind, QuestionSingle, QuestionMulti, QuestionNumeric, QuestionText), "kind", "must be single, multi, numeric or text")
+	v.Check(question.Prompt != "", "prompt", "must be provided")
+	v.Check(len(question.Prompt) <= maxPromptBytes, "prompt", fmt.Sprintf("must be no more than %d bytes long", maxPromptBytes))
+	v.Check(question.Points > 0, "points", "must be positive")
+
+	if question.Key == nil {
+		v.AddError("key", "must be provided")
+		return
+	}
+	key := question.Key
+
+	switch question.Kind {
+	case QuestionSingle, QuestionMulti:
+		v.Check(len(question.Options) >= 2, "options", "must have at least 2 options")
+		v.Check(len(question.Options) <= maxQuestionOptions, "options", fmt.Sprintf("must not have more than %d options", maxQuestionOptions))
+		for _, option := range question.Options {
+			v.Check(option.Text != "", "options", "must not be empty")
+			v.Check(len(option.Text) <= maxOptionBytes, "options", fmt.Sprintf("must be no more than %d bytes long each", maxOptionBytes))
+		}
+
+		seen := make(map[int]bool, len(key.Options))
+		for _, option := range key.Options {
+			v.Check(option >= 0 && option < len(question.Options) && !seen[option], "key.options", "must be distinct option ids")
+			seen[option] = true
+		}
+		if question.Kind == QuestionSingle {
+			v.Check(len(key.Options) == 1, "key.options", "must have exactly one option")
+		} else {
+			v.Check(len(key.Options) > 0, "key.options", "must have at least one option")
+		}
+
+	case QuestionNumeric:
+		v.Check(len(question.Options) == 0, "options", "must not be provided for numeric questions")
+		v.Check(key.Number != nil, "key.number", "must be provided")
+		v.Check(key.Tolerance >= 0, "key.tolerance", "must not be negative")
+
+	case QuestionText:
+		v.Check(len(question.Options) == 0, "options", "must not be provided for text questions")
+		v.Check(len(key.Texts) > 0, "key.texts", "must be provided")
+		v.Check(len(key.Texts) <= maxQuestionTexts, "key.texts", fmt.Sprintf("must not have more than %d texts", maxQuestionTexts))
+		v.Check(key.Match == "" || validator.In(key.Match, MatchExact, MatchRegex), "key.match", "must be exact or regex")
+		for _, text := range key.Texts {
+			v.Check(len(text) <= maxKeyTextBytes, "key.texts", fmt.Sprintf("must be no more than %d bytes long each", maxKeyTextBytes))
+			if key.Match == MatchRegex {
+				_, err := compileAnswer(text, key.CaseSensitive)
+				v.Check(err == nil, "key.texts", "must be valid regular expressions")
+			} else {
+				v.Check(strings.TrimSpace(text) != "", "key.texts", "must not be empty")
+			}
+		}
+	}
+}
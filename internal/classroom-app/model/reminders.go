@@ -0,0 +1,106 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// reminderLockKey is the key of the Postgres advisory lock held while reminders are sent, so
+// that only one instance sends them at a time.
+const reminderLockKey = 20_391_001
+
+type ReminderModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+}
+
+// SendDue notifies the students of the classrooms of a task who haven't submitted it yet when
+// it is due within one of the offsets, e.g. 24 hours and 1 hour. Every reminder is sent once
+// per task, offset and due date; when several offsets are reached at once, e.g. for a task
+// created an hour before it is due, one notification covers them. It returns the number of
+// tasks reminded of, which is 0 if another instance is sending reminders at the same time.
+func (m ReminderModel) SendDue(offsets []time.Duration) (int, error) {
+	query := `
+		WITH due AS (
+			SELECT t.id, t.due_at, o.secs
+			FROM task t, unnest($1::int[]) o(secs)
+			WHERE t.deleted_at IS NULL
+				AND t.due_at > now()
+				AND t.due_at - make_interval(secs => o.secs) <= now()
+		), sent AS (
+			INSERT INTO task_reminders (task_id, offset_seconds, due_at)
+			SELECT id, secs, due_at FROM due
+			ON CONFLICT DO NOTHING
+			RETURNING task_id
+		)
+		SELECT DISTINCT t.id, t.header, t.due_at
+		FROM task t
+			INNER JOIN sent s ON s.task_id = t.id
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// The lock is released when tx ends.
+	var locked bool
+	err = tx.QueryRowContext(ctx, `SELECT pg_try_advisory_xact_lock($1)`, reminderLockKey).Scan(&locked)
+	if err != nil || !locked {
+		return 0, err
+	}
+
+	secs := make([]int64, len(offsets))
+	for i, offset := range offsets {
+		secs[i] = int64(offset.Seconds())
+	}
+
+	rows, err := tx.QueryContext(ctx, query, pq.Array(secs))
+	if err != nil {
+		return 0, err
+	}
+
+	var reminders []*Notification
+	for rows.Next() {
+		var header string
+		var dueAt time.Time
+		notification := &Notification{Event: EventTaskDueSoon, EntityType: EntityTask}
+
+		if err := rows.Scan(&notification.EntityID, &header, &dueAt); err != nil {
+			rows.Close()
+			return 0, err
+		}
+
+		notification.Title = "Due " + dueAt.UTC().Format("2006-01-02 15:04 MST") + ": " + header
+		reminders = append(reminders, notification)
+	}
+	if err = rows.Err(); err != nil {
+		rows.Close()
+		return 0, err
+	}
+	if err = rows.Close(); err != nil {
+		return 0, err
+	}
+
+	// The notifications are created in the same transaction as the reminder rows, so a
+	// reminder is either recorded and sent or neither.
+	for _, notification := range reminders {
+		if err := insertNotifications(ctx, tx, notification, recipients{permission: "task:read", role: RoleStudent, unsubmitted: true}); err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return len(reminders), nil
+}
@@ -0,0 +1,218 @@
+package model
+
+import (
+	"FinalProject/internal/classroom-app/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"time"
+)
+
+// Room is a place class sessions take place in. A room can only be booked by one session at a
+// time.
+type Room struct {
+	Id        int       `json:"id"`
+	Name      string    `json:"name"`
+	Capacity  int       `json:"capacity"`
+	CreatedAt time.Time `json:"createdAt"`
+	Version   int       `json:"version"`
+}
+
+type RoomModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+}
+
+func (m RoomModel) Insert(room *Room, actor Actor) error {
+	query := `
+		INSERT INTO rooms (name, capacity)
+		VALUES ($1, $2)
+		RETURNING id, created_at, version
+		`
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, room.Name, room.Capacity).Scan(&room.Id, &room.CreatedAt, &room.Version)
+	if err != nil {
+		return duplicateRoom(err)
+	}
+
+	err = insertAuditEntry(ctx, tx, actor, AuditCreate, EntityRoom, room.Id, nil, room)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m RoomModel) Get(id int) (*Room, error) {
+	query := `
+		SELECT id, name, capacity, created_at, version FROM rooms
+		WHERE id = $1
+		`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var room Room
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&room.Id, &room.Name, &room.Capacity, &room.CreatedAt, &room.Version)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &room, nil
+}
+
+// GetAll returns the rooms ordered by name.
+func (m RoomModel) GetAll(filters Filters) ([]*Room, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), id, name, capacity, created_at, version FROM rooms
+		ORDER BY name, id
+		LIMIT $1 OFFSET $2
+		`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	totalRecords := 0
+
+	rooms := []*Room{}
+	for rows.Next() {
+		var room Room
+		err := rows.Scan(&totalRecords, &room.Id, &room.Name, &room.Capacity, &room.CreatedAt, &room.Version)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		rooms = append(rooms, &room)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return rooms, metadata, nil
+}
+
+// Update updates the room if its version hasn't changed since it was read, otherwise
+// ErrEditConflict is returned.
+func (m RoomModel) Update(room *Room, actor Actor) error {
+	query := `
+		UPDATE rooms
+		SET name = $1, capacity = $2, version = version + 1
+		WHERE id = $3
+		RETURNING version
+		`
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := m.getForUpdate(ctx, tx, room.Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	if before.Version != room.Version {
+		return ErrEditConflict
+	}
+
+	err = tx.QueryRowContext(ctx, query, room.Name, room.Capacity, room.Id).Scan(&room.Version)
+	if err != nil {
+		return duplicateRoom(err)
+	}
+
+	err = insertAuditEntry(ctx, tx, actor, AuditUpdate, EntityRoom, room.Id, before, room)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete deletes the room. Its sessions are kept without a room.
+func (m RoomModel) Delete(id int, actor Actor) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := m.getForUpdate(ctx, tx, id)
+	if err != nil {
+		return notFound(err)
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM rooms WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	err = insertAuditEntry(ctx, tx, actor, AuditDelete, EntityRoom, id, before, nil)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// getForUpdate reads a room and locks it until tx ends.
+func (m RoomModel) getForUpdate(ctx context.Context, tx *sql.Tx, id int) (*Room, error) {
+	query := `
+		SELECT id, name, capacity, created_at, version FROM rooms
+		WHERE id = $1
+		FOR UPDATE
+		`
+
+	var room Room
+	err := tx.QueryRowContext(ctx, query, id).Scan(&room.Id, &room.Name, &room.Capacity, &room.CreatedAt, &room.Version)
+	if err != nil {
+		return nil, err
+	}
+	return &room, nil
+}
+
+// duplicateRoom turns the error of writing a room with the name of another one into
+// FieldErrors.
+func duplicateRoom(err error) error {
+	if strings.Contains(err.Error(), `"rooms_name_key"`) {
+		return FieldErrors{"name": "a room with this name already exists"}
+	}
+	return err
+}
+
+func ValidateRoom(v *validator.Validator, room *Room) {
+	v.Check(room.Name != "", "name", "must be provided")
+	v.Check(len(room.Name) <= 100, "name", "must be no more than 100 bytes long")
+	v.Check(room.Capacity >= 0, "capacity", "must not be negative")
+}
@@ -0,0 +1,133 @@
+package model
+
+import (
+	"FinalProject/internal/classroom-app/validator"
+	"context"
+	"database/sql"
+	"html"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Search result types returned in the "type" field of a SearchResult.
+const (
+	SearchTypeClassroom = "classroom"
+	SearchTypeTask      = "task"
+)
+
+// searchWordRX matches the words of a search query. Everything else (operators, quotes,
+// punctuation) is dropped so that user input can never break the tsquery syntax.
+var searchWordRX = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// ts_headline marks matches with these private use characters, which are removed from the
+// searched text first. The snippet is HTML-escaped before they become <mark> tags, so text
+// users wrote can't come back as markup.
+const (
+	snippetStart = "\uE000"
+	snippetStop  = "\uE001"
+)
+
+var snippetMarks = strings.NewReplacer(snippetStart, "<mark>", snippetStop, "</mark>")
+
+// SearchResult is a search hit. Snippet is HTML with the matches in <mark> tags.
+type SearchResult struct {
+	Type    string  `json:"type"`
+	Id      int     `json:"id"`
+	Title   string  `json:"title"`
+	Snippet string  `json:"snippet"`
+	Rank    float64 `json:"rank"`
+}
+
+// SearchScope tells Search which entity types the caller is allowed to see.
+type SearchScope struct {
+	Classrooms bool
+	Tasks      bool
+}
+
+type SearchModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+}
+
+// Search runs a ranked full-text search across classrooms and tasks. Every word of the query
+// is matched as a prefix, so "calc" finds "Calculus".
+func (s SearchModel) Search(q string, scope SearchScope, filters Filters) ([]*SearchResult, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), type, id, title, snippet, rank
+		FROM (
+			SELECT 'classroom' AS type, c.id, c.name AS title,
+				ts_headline('simple', translate(c.name || ' ' || c.description, $6::text || $7::text, ''), q,
+					'StartSel=' || $6 || ', StopSel=' || $7 || ', MaxFragments=2, MaxWords=20, MinWords=5') AS snippet,
+				ts_rank(c.search_vector, q) AS rank
+			FROM classroom c, to_tsquery('simple', $1) q
+			WHERE $2 AND c.deleted_at IS NULL AND c.search_vector @@ q
+			UNION ALL
+			SELECT 'task' AS type, t.id, t.header AS title,
+				ts_headline('simple', translate(t.header || ' ' || t.description, $6::text || $7::text, ''), q,
+					'StartSel=' || $6 || ', StopSel=' || $7 || ', MaxFragments=2, MaxWords=20, MinWords=5') AS snippet,
+				ts_rank(t.search_vector, q) AS rank
+			FROM task t, to_tsquery('simple', $1) q
+			WHERE $3 AND t.deleted_at IS NULL AND t.search_vector @@ q
+		) results
+		ORDER BY rank DESC, type ASC, id ASC
+		LIMIT $4 OFFSET $5
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{prefixTSQuery(q), scope.Classrooms, scope.Tasks, filters.limit(), filters.offset(), snippetStart, snippetStop}
+
+	rows, err := s.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			s.ErrorLog.Println(err)
+		}
+	}()
+
+	totalRecords := 0
+
+	results := []*SearchResult{}
+	for rows.Next() {
+		var result SearchResult
+		err := rows.Scan(&totalRecords, &result.Type, &result.Id, &result.Title, &result.Snippet, &result.Rank)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		result.Snippet = snippetMarks.Replace(html.EscapeString(result.Snippet))
+		results = append(results, &result)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return results, metadata, nil
+}
+
+// prefixTSQuery turns free text into a tsquery where every word must match as a prefix,
+// e.g. "linear alg" becomes "linear:* & alg:*".
+func prefixTSQuery(q string) string {
+	words := searchWordRX.FindAllString(strings.ToLower(q), -1)
+	for i := range words {
+		words[i] += ":*"
+	}
+
+	return strings.Join(words, " & ")
+}
+
+func ValidateSearchQuery(v *validator.Validator, q string) {
+	v.Check(q != "", "q", "must be provided")
+	v.Check(len(q) <= 200, "q", "must be no more than 200 bytes long")
+	v.Check(prefixTSQuery(q) != "", "q", "must contain at least one word")
+}
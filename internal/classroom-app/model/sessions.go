@@ -0,0 +1,492 @@
+package model
+
+import (
+	"FinalProject/internal/classroom-app/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// clockLayout is the layout of the times of day class sessions start and end at.
+const clockLayout = "15:04"
+
+// ErrRoomBooked is returned when a class session would book a room that another session has
+// booked at the same time.
+var ErrRoomBooked = errors.New("room booked")
+
+// ClassSession is a weekly meeting of a classroom. It takes place every Weekday (0 is Sunday)
+// from StartsAt to EndsAt, between the dates StartsOn and EndsOn, except on the dates in
+// Exceptions. Times are wall clock times of the school.
+type ClassSession struct {
+	Id         int       `json:"id"`
+	ClassId    int       `json:"classId"`
+	RoomId     *int      `json:"roomId"`
+	Weekday    int       `json:"weekday"`
+	StartsAt   string    `json:"startsAt"`
+	EndsAt     string    `json:"endsAt"`
+	StartsOn   string    `json:"startsOn"`
+	EndsOn     string    `json:"endsOn"`
+	Exceptions []string  `json:"exceptions"`
+	CreatedAt  time.Time `json:"createdAt"`
+	Version    int       `json:"version"`
+}
+
+// TimetableSession is a class session with the names of its classroom and room.
+type TimetableSession struct {
+	ClassSession
+	ClassName string  `json:"className"`
+	RoomName  *string `json:"roomName"`
+}
+
+// TimetableEntry is one occurrence of a class session.
+type TimetableEntry struct {
+	Date      string  `json:"date"`
+	StartsAt  string  `json:"startsAt"`
+	EndsAt    string  `json:"endsAt"`
+	SessionId int     `json:"sessionId"`
+	ClassId   int     `json:"classId"`
+	ClassName string  `json:"className"`
+	RoomId    *int    `json:"roomId"`
+	RoomName  *string `json:"roomName"`
+}
+
+type SessionModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+}
+
+const sessionColumns = `
+		s.id, s.class_id, s.room_id, s.weekday, to_char(s.starts_at, 'HH24:MI'),
+		to_char(s.ends_at, 'HH24:MI'), s.starts_on::text, s.ends_on::text, s.exceptions::text[],
+		s.created_at, s.version`
+
+// Insert adds a session to its classroom. It returns ErrRecordNotFound if the classroom doesn't
+// exist or is deleted, ErrArchived if it is archived, ErrRoomBooked if the room is taken and
+// FieldErrors if the room doesn't exist.
+func (m SessionModel) Insert(session *ClassSession, actor Actor) error {
+	query := `
+		INSERT INTO class_sessions (class_id, room_id, weekday, starts_at, ends_at, starts_on, ends_on, exceptions)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8::date[])
+		RETURNING id, created_at, version
+		`
+	if session.Exceptions == nil {
+		session.Exceptions = []string{}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = lockWritableClassroom(ctx, tx, session.ClassId); err != nil {
+		return err
+	}
+
+	args := []any{
+		session.ClassId,
+		session.RoomId,
+		session.Weekday,
+		session.StartsAt,
+		session.EndsAt,
+		session.StartsOn,
+		session.EndsOn,
+		pq.Array(session.Exceptions),
+	}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&session.Id, &session.CreatedAt, &session.Version)
+	if err != nil {
+		return sessionError(err)
+	}
+
+	err = insertAuditEntry(ctx, tx, actor, AuditCreate, EntitySession, session.Id, nil, session)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m SessionModel) Get(id int) (*ClassSession, error) {
+	query := `SELECT ` + sessionColumns + `
+		FROM class_sessions s
+		WHERE s.id = $1
+		`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	session, err := scanSession(m.DB.QueryRowContext(ctx, query, id))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return session, nil
+}
+
+// GetAllOfClass returns the sessions of the classroom in the order of the week.
+func (m SessionModel) GetAllOfClass(classId int) ([]*ClassSession, error) {
+	query := `SELECT ` + sessionColumns + `
+		FROM class_sessions s
+		WHERE s.class_id = $1
+		ORDER BY s.weekday, s.starts_at, s.id
+		`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, classId)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	sessions := []*ClassSession{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// GetForUser returns the sessions of the classrooms the user is a member of that haven't ended
+// before since, with the names of their classrooms and rooms.
+func (m SessionModel) GetForUser(userId int, since time.Time) ([]*TimetableSession, error) {
+	query := `SELECT ` + sessionColumns + `, c.name, r.name
+		FROM class_sessions s
+			INNER JOIN classroom c ON c.id = s.class_id AND c.deleted_at IS NULL
+			INNER JOIN classroom_members cm ON cm.class_id = s.class_id AND cm.user_id = $1
+			LEFT JOIN rooms r ON r.id = s.room_id
+		WHERE s.ends_on >= $2::date
+		ORDER BY s.starts_on, s.id
+		`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userId, since.Format(dateLayout))
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	sessions := []*TimetableSession{}
+	for rows.Next() {
+		var session TimetableSession
+		err := rows.Scan(
+			&session.Id,
+			&session.ClassId,
+			&session.RoomId,
+			&session.Weekday,
+			&session.StartsAt,
+			&session.EndsAt,
+			&session.StartsOn,
+			&session.EndsOn,
+			pq.Array(&session.Exceptions),
+			&session.CreatedAt,
+			&session.Version,
+			&session.ClassName,
+			&session.RoomName,
+		)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, &session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// Timetable returns every occurrence of the sessions of the classrooms the user is a member of
+// from the date from to the date to, both included, in the order they take place.
+func (m SessionModel) Timetable(userId int, from, to string) ([]*TimetableEntry, error) {
+	query := `
+		SELECT d::date::text, to_char(s.starts_at, 'HH24:MI'), to_char(s.ends_at, 'HH24:MI'),
+			s.id, s.class_id, c.name, s.room_id, r.name
+		FROM class_sessions s
+			INNER JOIN classroom c ON c.id = s.class_id AND c.deleted_at IS NULL
+			INNER JOIN classroom_members cm ON cm.class_id = s.class_id AND cm.user_id = $1
+			LEFT JOIN rooms r ON r.id = s.room_id
+			CROSS JOIN LATERAL generate_series(
+				GREATEST(s.starts_on, $2::date), LEAST(s.ends_on, $3::date), interval '1 day'
+			) d
+		WHERE EXTRACT(dow FROM d) = s.weekday AND NOT d::date = ANY(s.exceptions)
+		ORDER BY d, s.starts_at, s.id
+		`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userId, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	entries := []*TimetableEntry{}
+	for rows.Next() {
+		var entry TimetableEntry
+		err := rows.Scan(
+			&entry.Date,
+			&entry.StartsAt,
+			&entry.EndsAt,
+			&entry.SessionId,
+			&entry.ClassId,
+			&entry.ClassName,
+			&entry.RoomId,
+			&entry.RoomName,
+		)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &entry)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// Update updates the session if its version hasn't changed since it was read, otherwise
+// ErrEditConflict is returned. Like Insert it returns ErrArchived, ErrRoomBooked or
+// FieldErrors.
+func (m SessionModel) Update(session *ClassSession, actor Actor) error {
+	query := `
+		UPDATE class_sessions
+		SET room_id = $1, weekday = $2, starts_at = $3, ends_at = $4, starts_on = $5, ends_on = $6,
+			exceptions = $7::date[], version = version + 1
+		WHERE id = $8
+		RETURNING version
+		`
+	if session.Exceptions == nil {
+		session.Exceptions = []string{}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := m.getForUpdate(ctx, tx, session.Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	if before.Version != session.Version {
+		return ErrEditConflict
+	}
+
+	if err = lockWritableClassroom(ctx, tx, before.ClassId); err != nil {
+		return err
+	}
+
+	args := []any{
+		session.RoomId,
+		session.Weekday,
+		session.StartsAt,
+		session.EndsAt,
+		session.StartsOn,
+		session.EndsOn,
+		pq.Array(session.Exceptions),
+		session.Id,
+	}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&session.Version)
+	if err != nil {
+		return sessionError(err)
+	}
+
+	err = insertAuditEntry(ctx, tx, actor, AuditUpdate, EntitySession, session.Id, before, session)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete deletes the session for good. It returns ErrArchived if its classroom is archived.
+func (m SessionModel) Delete(id int, actor Actor) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := m.getForUpdate(ctx, tx, id)
+	if err != nil {
+		return notFound(err)
+	}
+
+	if err = lockWritableClassroom(ctx, tx, before.ClassId); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM class_sessions WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	err = insertAuditEntry(ctx, tx, actor, AuditDelete, EntitySession, id, before, nil)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// TakesPlaceOn reports whether the session takes place on the date, like 2006-01-02.
+func (s *ClassSession) TakesPlaceOn(date string) bool {
+	d, err := time.Parse(dateLayout, date)
+	if err != nil || date < s.StartsOn || date > s.EndsOn || int(d.Weekday()) != s.Weekday {
+		return false
+	}
+	return !slices.Contains(s.Exceptions, date)
+}
+
+// getForUpdate reads a session and locks it until tx ends.
+func (m SessionModel) getForUpdate(ctx context.Context, tx *sql.Tx, id int) (*ClassSession, error) {
+	query := `SELECT ` + sessionColumns + `
+		FROM class_sessions s
+		WHERE s.id = $1
+		FOR UPDATE
+		`
+	return scanSession(tx.QueryRowContext(ctx, query, id))
+}
+
+// lockWritableClassroom locks the classroom until tx ends, so it can't be archived or deleted
+// before tx commits. It returns ErrRecordNotFound if the classroom doesn't exist or is deleted
+// and ErrArchived if it is archived.
+func lockWritableClassroom(ctx context.Context, tx *sql.Tx, classId int) error {
+	query := `
+		SELECT archived_at IS NOT NULL FROM classroom
+		WHERE id = $1 AND deleted_at IS NULL
+		FOR SHARE
+		`
+
+	var archived bool
+	if err := tx.QueryRowContext(ctx, query, classId).Scan(&archived); err != nil {
+		return notFound(err)
+	}
+	if archived {
+		return ErrArchived
+	}
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSession(row rowScanner) (*ClassSession, error) {
+	var session ClassSession
+	err := row.Scan(
+		&session.Id,
+		&session.ClassId,
+		&session.RoomId,
+		&session.Weekday,
+		&session.StartsAt,
+		&session.EndsAt,
+		&session.StartsOn,
+		&session.EndsOn,
+		pq.Array(&session.Exceptions),
+		&session.CreatedAt,
+		&session.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// sessionError turns the errors of writing a session that books a taken room or a room that
+// doesn't exist into ErrRoomBooked and FieldErrors.
+func sessionError(err error) error {
+	switch {
+	case strings.Contains(err.Error(), `"class_sessions_room_overlap"`):
+		return ErrRoomBooked
+	case strings.Contains(err.Error(), `"class_sessions_room_id_fkey"`):
+		return FieldErrors{"roomId": "room does not exist"}
+	default:
+		return err
+	}
+}
+
+// maxSessionExceptions is the largest number of dates a session can be cancelled on.
+const maxSessionExceptions = 100
+
+func ValidateClassSession(v *validator.Validator, session *ClassSession) {
+	v.Check(session.RoomId == nil || *session.RoomId > 0, "roomId", "must be a valid room id")
+	v.Check(session.Weekday >= 0 && session.Weekday <= 6, "weekday", "must be between 0 (Sunday) and 6 (Saturday)")
+
+	startsAt, err := time.Parse(clockLayout, session.StartsAt)
+	v.Check(err == nil, "startsAt", "must be a time like 15:04")
+	endsAt, err := time.Parse(clockLayout, session.EndsAt)
+	v.Check(err == nil, "endsAt", "must be a time like 15:04")
+	if v.Errors["startsAt"] == "" && v.Errors["endsAt"] == "" {
+		v.Check(endsAt.After(startsAt), "endsAt", "must be after startsAt")
+	}
+
+	startsOn, err := time.Parse(dateLayout, session.StartsOn)
+	v.Check(err == nil, "startsOn", "must be a date like 2006-01-02")
+	endsOn, err := time.Parse(dateLayout, session.EndsOn)
+	v.Check(err == nil, "endsOn", "must be a date like 2006-01-02")
+	datesValid := v.Errors["startsOn"] == "" && v.Errors["endsOn"] == ""
+	if datesValid {
+		v.Check(!endsOn.Before(startsOn), "endsOn", "must not be before startsOn")
+	}
+
+	v.Check(len(session.Exceptions) <= maxSessionExceptions, "exceptions", fmt.Sprintf("must not have more than %d dates", maxSessionExceptions))
+	for _, exception := range session.Exceptions {
+		date, err := time.Parse(dateLayout, exception)
+		if err != nil {
+			v.AddError("exceptions", "must be dates like 2006-01-02")
+			break
+		}
+		if datesValid && (date.Before(startsOn) || date.After(endsOn) || int(date.Weekday()) != session.Weekday) {
+			v.AddError("exceptions", fmt.Sprintf("%s is not a date the session takes place on", exception))
+			break
+		}
+	}
+}
@@ -5,17 +5,23 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"log"
-	"sort"
+	"slices"
+	"strconv"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type Task struct {
-	Id          int    `json:"id"`
-	Header      string `json:"header"`
-	Description string `json:"description"`
-	CreatedAt   string `json:"createdAt"`
-	UpdatedAt   string `json:"UpdatedAt"`
+	Id          int        `json:"id"`
+	Header      string     `json:"header"`
+	Description string     `json:"description"`
+	DueAt       *time.Time `json:"dueAt"`
+	CreatedAt   string     `json:"createdAt"`
+	UpdatedAt   string     `json:"UpdatedAt"`
+	Version     int        `json:"version"`
 }
 
 type TaskModel struct {
@@ -24,54 +30,74 @@ type TaskModel struct {
 	ErrorLog *log.Logger
 }
 
-func (t *TaskModel) Insert(task *Task, classroomIds ...int) error {
+func (t *TaskModel) Insert(task *Task, actor Actor, classroomIds ...int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := t.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = t.insert(ctx, tx, task, actor, classroomIds...); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insert inserts the task, links it to the classrooms and adds its audit entry as part of tx.
+func (t *TaskModel) insert(ctx context.Context, tx *sql.Tx, task *Task, actor Actor, classroomIds ...int) error {
 	query := `
-		INSERT INTO task (header, description)
-		VALUES($1, $2)
-		RETURNING id, created_at, updated_at
+		INSERT INTO task (header, description, due_at)
+		VALUES($1, $2, $3)
+		RETURNING id, created_at, updated_at, version
 `
 
-	args := []any{task.Header, task.Description}
+	if len(classroomIds) > 0 {
+		if err := lockClassrooms(ctx, tx, classroomIds); err != nil {
+			return err
+		}
+	}
+
+	args := []any{task.Header, task.Description, task.DueAt}
 
-	tx, err := t.DB.BeginTx(context.Background(), nil)
+	err := tx.QueryRowContext(ctx, query, args...).Scan(&task.Id, &task.CreatedAt, &task.UpdatedAt, &task.Version)
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback()
-
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	tx.QueryRowContext(ctx, query, args...).Scan(&task.Id, &task.CreatedAt, &task.UpdatedAt)
 
 	query = `
 		INSERT INTO classroom_task (class_id, task_id) 
 		VALUES ($1, $2)
 `
 	for _, classId := range classroomIds {
-		ctx, _ := context.WithTimeout(context.Background(), 3*time.Second)
 		_, err = tx.ExecContext(ctx, query, classId, task.Id)
 		if err != nil {
 			return err
 		}
 	}
 
-	if err = tx.Commit(); err != nil {
-		return err
-	}
-	return nil
+	after := struct {
+		*Task
+		Classrooms []int `json:"classrooms"`
+	}{task, classroomIds}
+
+	return insertAuditEntry(ctx, tx, actor, AuditCreate, EntityTask, task.Id, nil, after)
 }
 
 func (t *TaskModel) Get(id int) (*Task, error) {
 	query := `
-		SELECT id, header, description, created_at, updated_at FROM task
-		WHERE id=$1
+		SELECT id, header, description, created_at, updated_at, version, due_at FROM task
+		WHERE id=$1 AND deleted_at IS NULL
 `
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	var task Task
 	row := t.DB.QueryRowContext(ctx, query, id)
-	err := row.Scan(&task.Id, &task.Header, &task.Description, &task.CreatedAt, &task.UpdatedAt)
+	err := row.Scan(&task.Id, &task.Header, &task.Description, &task.CreatedAt, &task.UpdatedAt, &task.Version, &task.DueAt)
 
 	if err != nil {
 		return nil, err
@@ -80,39 +106,53 @@ func (t *TaskModel) Get(id int) (*Task, error) {
 }
 
 func (t *TaskModel) GetTasksOfClass(classId int, header string, filters Filters) (*[]Task, Metadata, error) {
-	query := `
-		SELECT task_id FROM classroom_task
-		WHERE class_id=$1
+	column := taskSortColumn(filters.sortColumn())
+	keyset, keysetArgs := filters.keyset("t."+column, "t.id", 5)
+	filter, filterArgs := filters.filterClause(5 + len(keysetArgs))
+
+	query := fmt.Sprintf(
 		`
+		SELECT count(*) OVER(), t.id, t.header, t.description, t.created_at, t.updated_at, t.version, t.due_at
+		FROM task t
+			INNER JOIN classroom_task ct ON ct.task_id = t.id
+			INNER JOIN classroom c ON c.id = ct.class_id
+		WHERE ct.class_id = $1
+			AND t.deleted_at IS NULL
+			AND c.deleted_at IS NULL
+			AND (LOWER(t.header) = LOWER($2) OR $2 = '')
+			AND %s
+			AND %s
+		ORDER BY t.%s %s, t.id %s
+		LIMIT $3 OFFSET $4
+		`,
+		keyset, filter, column, filters.sortDirection(), filters.sortDirection())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	// Fetch one extra row to find out whether there is a next page.
+	args := []any{classId, header, filters.limit() + 1, filters.offset()}
+	args = append(args, keysetArgs...)
+	args = append(args, filterArgs...)
 
-	rows, err := t.DB.Query(query, classId)
+	rows, err := t.DB.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, Metadata{}, err
 	}
-	defer rows.Close()
 
-	var tasks []Task
-	for rows.Next() {
-		var taskId *int
-		err = rows.Scan(&taskId)
-		if err != nil {
-			return nil, Metadata{}, err
+	defer func() {
+		if err := rows.Close(); err != nil {
+			t.ErrorLog.Println(err)
 		}
+	}()
+
+	totalRecords := 0
 
+	tasks := []Task{}
+	for rows.Next() {
 		var task Task
-		query = `
-			SELECT id, header, description, created_at, updated_at 
-			FROM task
-			WHERE id=$1 and (LOWER(header) = LOWER($2) OR $2 = '')
-			`
-
-		args := []interface{}{taskId, header}
-		row := t.DB.QueryRow(query, args...)
-		err = row.Scan(&task.Id, &task.Header, &task.Description, &task.CreatedAt, &task.UpdatedAt)
+		err = rows.Scan(&totalRecords, &task.Id, &task.Header, &task.Description, &task.CreatedAt, &task.UpdatedAt, &task.Version, &task.DueAt)
 		if err != nil {
-			if errors.Is(err, sql.ErrNoRows) {
-				continue
-			}
 			return nil, Metadata{}, err
 		}
 
@@ -123,61 +163,717 @@ func (t *TaskModel) GetTasksOfClass(classId int, header string, filters Filters)
 		return nil, Metadata{}, err
 	}
 
-	if filters.sortColumn() == "date" {
-		if filters.sortDirection() == "ASC" {
-			sort.Slice(tasks, func(i, j int) bool {
-				return tasks[i].CreatedAt < tasks[j].CreatedAt
-			})
-		} else if filters.sortDirection() == "DESC" {
-			sort.Slice(tasks, func(i, j int) bool {
-				return tasks[i].CreatedAt > tasks[j].CreatedAt
-			})
-		}
+	fetched := len(tasks)
+	if fetched > filters.limit() {
+		tasks = tasks[:filters.limit()]
 	}
 
-	totalRecords := len(tasks)
-	st := filters.PageSize * (filters.Page - 1)
-	en := min(len(tasks), st+filters.PageSize)
-	if st < len(tasks) {
-		tasks = tasks[st:en]
-	} else {
-		tasks = []Task{}
+	var metadata Metadata
+	if len(tasks) > 0 {
+		last := tasks[len(tasks)-1]
+		metadata = calculateListMetadata(filters, totalRecords, fetched, last.Id, last.sortKey(column))
 	}
 
-	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
-
 	return &tasks, metadata, nil
 }
 
-func (t *TaskModel) Update(task *Task) error {
+// taskSortColumn maps a sort value of the task list to its column in the task table.
+func taskSortColumn(sort string) string {
+	switch sort {
+	case "date":
+		return "created_at"
+	default:
+		return sort
+	}
+}
+
+// sortKey returns the value of the column the task list is sorted by.
+func (t *Task) sortKey(column string) string {
+	switch column {
+	case "created_at":
+		return t.CreatedAt
+	case "updated_at":
+		return t.UpdatedAt
+	default:
+		return strconv.Itoa(t.Id)
+	}
+}
+
+// getForUpdate reads a task that isn't deleted and locks it until tx ends.
+func (t *TaskModel) getForUpdate(ctx context.Context, tx *sql.Tx, id int) (*Task, error) {
+	query := `
+		SELECT id, header, description, created_at, updated_at, version, due_at FROM task
+		WHERE id=$1 AND deleted_at IS NULL
+		FOR UPDATE
+`
+
+	var task Task
+	err := tx.QueryRowContext(ctx, query, id).Scan(
+		&task.Id,
+		&task.Header,
+		&task.Description,
+		&task.CreatedAt,
+		&task.UpdatedAt,
+		&task.Version,
+		&task.DueAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// Update updates the task if its version hasn't changed since it was read, otherwise
+// ErrEditConflict is returned.
+func (t *TaskModel) Update(task *Task, actor Actor) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := t.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = t.update(ctx, tx, task, actor); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// update updates the task and adds its audit entry as part of tx.
+func (t *TaskModel) update(ctx context.Context, tx *sql.Tx, task *Task, actor Actor) error {
 	query := `
 		UPDATE task
-		SET header=$1, description=$2, updated_at=current_timestamp
-		WHERE id=$3 and updated_at=$4
-		RETURNING updated_at
+		SET header=$1, description=$2, due_at=$3, updated_at=current_timestamp, version=version+1
+		WHERE id=$4
+		RETURNING updated_at, version
 `
+
+	before, err := t.getForUpdate(ctx, tx, task.Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	if before.Version != task.Version {
+		return ErrEditConflict
+	}
+	if err := checkNotArchived(ctx, tx, task.Id); err != nil {
+		return err
+	}
+
+	args := []any{task.Header, task.Description, task.DueAt, task.Id}
+
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&task.UpdatedAt, &task.Version)
+	if err != nil {
+		return err
+	}
+
+	return insertAuditEntry(ctx, tx, actor, AuditUpdate, EntityTask, task.Id, before, task)
+}
+
+// Delete moves the task to the trash of the user who deleted it. When version is not 0 the
+// task is only deleted if it still has that version, otherwise ErrEditConflict is returned.
+func (t *TaskModel) Delete(id int, version int, actor Actor) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	args := []any{task.Header, task.Description, task.Id, task.UpdatedAt}
+	tx, err := t.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = t.delete(ctx, tx, id, version, actor); err != nil {
+		return err
+	}
 
-	return t.DB.QueryRowContext(ctx, query, args...).Scan(&task.UpdatedAt)
+	return tx.Commit()
 }
 
-func (t *TaskModel) Delete(id int) error {
+// delete moves the task to the trash and adds its audit entry as part of tx.
+func (t *TaskModel) delete(ctx context.Context, tx *sql.Tx, id int, version int, actor Actor) error {
 	query := `
-		DELETE FROM task
+		UPDATE task
+		SET deleted_at=now(), deleted_by=$2, version=version+1
 		WHERE id=$1
 `
+
+	before, err := t.getForUpdate(ctx, tx, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows) && version != 0:
+			return ErrEditConflict
+		case errors.Is(err, sql.ErrNoRows):
+			return nil
+		default:
+			return err
+		}
+	}
+
+	if version != 0 && before.Version != version {
+		return ErrEditConflict
+	}
+	if err := checkNotArchived(ctx, tx, id); err != nil {
+		return err
+	}
+
+	var deletedBy *int
+	if actor.UserID != 0 {
+		deletedBy = &actor.UserID
+	}
+
+	_, err = tx.ExecContext(ctx, query, id, deletedBy)
+	if err != nil {
+		return err
+	}
+
+	return insertAuditEntry(ctx, tx, actor, AuditDelete, EntityTask, id, before, nil)
+}
+
+// Restore takes a deleted task out of the trash. It returns ErrRecordNotFound if the task
+// doesn't exist or isn't deleted.
+func (t *TaskModel) Restore(id int, actor Actor) (*Task, error) {
+	query := `
+		UPDATE task
+		SET deleted_at=NULL, deleted_by=NULL, version=version+1,
+			orphaned_at=CASE WHEN EXISTS (SELECT 1 FROM classroom_task WHERE task_id = $1) THEN NULL ELSE now() END
+		WHERE id=$1 AND deleted_at IS NOT NULL
+		RETURNING id, header, description, created_at, updated_at, version, due_at
+`
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := t.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var task Task
+	err = tx.QueryRowContext(ctx, query, id).Scan(
+		&task.Id,
+		&task.Header,
+		&task.Description,
+		&task.CreatedAt,
+		&task.UpdatedAt,
+		&task.Version,
+		&task.DueAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	err = insertAuditEntry(ctx, tx, actor, AuditRestore, EntityTask, id, nil, &task)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &task, nil
+}
+
+// GetDue returns the tasks with a due date that belong to at least one classroom the user is a
+// member of, or to the given classroom if classId isn't 0, ordered by due date. Tasks that were
+// due more than since ago are left out.
+func (t *TaskModel) GetDue(userID, classId int, since time.Duration) ([]Task, error) {
+	query := `
+		SELECT t.id, t.header, t.description, t.created_at, t.updated_at, t.version, t.due_at
+		FROM task t
+		WHERE t.deleted_at IS NULL
+			AND t.due_at >= $2
+			AND EXISTS (
+				SELECT 1 FROM classroom_task ct
+					INNER JOIN classroom c ON c.id = ct.class_id
+					INNER JOIN classroom_members cm ON cm.class_id = ct.class_id AND cm.user_id = $3
+				WHERE ct.task_id = t.id
+					AND c.deleted_at IS NULL
+					AND (ct.class_id = $1 OR $1 = 0)
+			)
+		ORDER BY t.due_at, t.id
+`
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	_, err := t.DB.ExecContext(ctx, query, id)
-	return err
+	rows, err := t.DB.QueryContext(ctx, query, classId, time.Now().Add(-since), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			t.ErrorLog.Println(err)
+		}
+	}()
+
+	tasks := []Task{}
+	for rows.Next() {
+		var task Task
+		err := rows.Scan(&task.Id, &task.Header, &task.Description, &task.CreatedAt, &task.UpdatedAt, &task.Version, &task.DueAt)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// GetClassroomIds returns the ids of the classrooms the task belongs to, also when the task
+// has been deleted.
+func (t *TaskModel) GetClassroomIds(id int) ([]int, error) {
+	query := `
+		SELECT class_id FROM classroom_task
+		WHERE task_id=$1
+		ORDER BY class_id
+`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := t.DB.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			t.ErrorLog.Println(err)
+		}
+	}()
+
+	var ids []int
+	for rows.Next() {
+		var classId int
+		if err := rows.Scan(&classId); err != nil {
+			return nil, err
+		}
+		ids = append(ids, classId)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+// GetClassrooms returns the classrooms the task belongs to that aren't deleted, ordered by
+// name. It returns ErrRecordNotFound if the task doesn't exist or is deleted.
+func (t *TaskModel) GetClassrooms(id int) ([]*Classroom, error) {
+	query := `
+		SELECT c.id, c.name, c.description, c.created_at, c.updated_at, c.version, c.term_id, c.archived_at
+		FROM classroom_task ct
+			INNER JOIN classroom c ON c.id = ct.class_id
+		WHERE ct.task_id = $1 AND c.deleted_at IS NULL
+		ORDER BY c.name, c.id
+`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var exists bool
+	err := t.DB.QueryRowContext(ctx, `SELECT true FROM task WHERE id = $1 AND deleted_at IS NULL`, id).Scan(&exists)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	rows, err := t.DB.QueryContext(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			t.ErrorLog.Println(err)
+		}
+	}()
+
+	classrooms := []*Classroom{}
+	for rows.Next() {
+		var classroom Classroom
+		err := rows.Scan(&classroom.Id, &classroom.Name, &classroom.Description, &classroom.CreatedAt, &classroom.UpdatedAt, &classroom.Version, &classroom.TermId, &classroom.ArchivedAt)
+		if err != nil {
+			return nil, err
+		}
+		classrooms = append(classrooms, &classroom)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	return classrooms, nil
+}
+
+// Attach links the task to the classrooms it isn't linked to yet, and returns the ids of the
+// classrooms that were newly linked. It returns ErrRecordNotFound if the task doesn't exist or
+// is deleted, and FieldErrors if one of the classrooms doesn't exist or is deleted.
+func (t *TaskModel) Attach(id int, classroomIds []int, actor Actor) ([]int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := t.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := t.getForUpdate(ctx, tx, id); err != nil {
+		return nil, notFound(err)
+	}
+	if err := checkNotArchived(ctx, tx, id); err != nil {
+		return nil, err
+	}
+
+	if err := lockClassrooms(ctx, tx, classroomIds); err != nil {
+		return nil, err
+	}
+
+	before, err := classroomIdsOf(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		INSERT INTO classroom_task (class_id, task_id)
+		SELECT unnest($2::int[]), $1
+		ON CONFLICT DO NOTHING
+		RETURNING class_id
+`, id, pq.Array(classroomIds))
+	if err != nil {
+		return nil, err
+	}
+	attached, err := scanIds(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(attached) == 0 {
+		return attached, tx.Commit()
+	}
+
+	_, err = tx.ExecContext(ctx, `UPDATE task SET orphaned_at = NULL WHERE id = $1`, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = t.auditLinks(ctx, tx, id, before, actor); err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return attached, nil
+}
+
+// Detach removes the link between the task and the classroom. It returns ErrRecordNotFound if
+// the task doesn't exist, is deleted or isn't linked to the classroom. When the task is left
+// without a classroom it is marked as orphaned.
+func (t *TaskModel) Detach(id int, classId int, actor Actor) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := t.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := t.getForUpdate(ctx, tx, id); err != nil {
+		return notFound(err)
+	}
+	if err := checkNotArchived(ctx, tx, id); err != nil {
+		return err
+	}
+
+	before, err := classroomIdsOf(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM classroom_task WHERE task_id = $1 AND class_id = $2`, id, classId)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+
+	if len(before) == 1 {
+		_, err = tx.ExecContext(ctx, `UPDATE task SET orphaned_at = now() WHERE id = $1`, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = t.auditLinks(ctx, tx, id, before, actor); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// auditLinks adds an audit entry of the task with its classrooms before and after they were
+// changed in tx.
+func (t *TaskModel) auditLinks(ctx context.Context, tx *sql.Tx, id int, before []int, actor Actor) error {
+	after, err := classroomIdsOf(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+
+	return insertAuditEntry(ctx, tx, actor, AuditUpdate, EntityTask, id,
+		map[string]any{"classrooms": before}, map[string]any{"classrooms": after})
+}
+
+// TrashOrphaned moves the tasks that have belonged to no classroom for longer than olderThan
+// to the trash. Tasks that never belonged to a classroom count from when they were created.
+// Each task goes to the trash of the last user who changed it according to the audit log,
+// usually the one who detached it from its last classroom, or else the one who created it,
+// so that someone can still restore it. It works in batches of batchSize tasks, each in a
+// transaction of its own together with the audit entries of the tasks, and returns the number
+// of tasks it moved.
+func (t *TaskModel) TrashOrphaned(olderThan time.Duration, batchSize int) (int64, error) {
+	query := `
+		UPDATE task
+		SET deleted_at = now(), version = version + 1, deleted_by = (
+			SELECT a.actor_id FROM audit_log a
+				INNER JOIN users u ON u.id = a.actor_id
+			WHERE a.entity_type = 'task' AND a.entity_id = task.id
+			ORDER BY a.id DESC
+			LIMIT 1
+		)
+		WHERE id IN (
+			SELECT id FROM task
+			WHERE deleted_at IS NULL
+				AND COALESCE(orphaned_at, created_at) < $1
+				AND NOT EXISTS (SELECT 1 FROM classroom_task WHERE task_id = task.id)
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, header, description, created_at, updated_at, version, due_at
+`
+	cutoff := time.Now().Add(-olderThan)
+
+	var trashed int64
+	for {
+		n, err := t.trashBatch(query, cutoff, batchSize)
+		trashed += n
+		if err != nil || n < int64(batchSize) {
+			return trashed, err
+		}
+	}
+}
+
+func (t *TaskModel) trashBatch(query string, cutoff time.Time, batchSize int) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := t.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, cutoff, batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	var tasks []Task
+	for rows.Next() {
+		var task Task
+		err := rows.Scan(&task.Id, &task.Header, &task.Description, &task.CreatedAt, &task.UpdatedAt, &task.Version, &task.DueAt)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		tasks = append(tasks, task)
+	}
+	if err = rows.Err(); err != nil {
+		rows.Close()
+		return 0, err
+	}
+	if err = rows.Close(); err != nil {
+		return 0, err
+	}
+
+	for _, task := range tasks {
+		err := insertAuditEntry(ctx, tx, Actor{}, AuditDelete, EntityTask, task.Id, &task, nil)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int64(len(tasks)), nil
+}
+
+// Copy creates an independent copy of the task in each of the classrooms, with its due date
+// shifted by offset. It returns ErrRecordNotFound if the task doesn't exist or is deleted, and
+// FieldErrors if one of the classrooms doesn't exist or the shifted due date isn't valid.
+func (t *TaskModel) Copy(id int, classroomIds []int, offset time.Duration, actor Actor) ([]*Task, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := t.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	source, err := t.getForUpdate(ctx, tx, id)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	tasks, err := t.insertCopies(ctx, tx, source, classroomIds, offset, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// insertCopies inserts a copy of source, with its due date shifted by offset, in each of the
+// classrooms as part of tx.
+func (t *TaskModel) insertCopies(ctx context.Context, tx *sql.Tx, source *Task, classroomIds []int, offset time.Duration, actor Actor) ([]*Task, error) {
+	var dueAt *time.Time
+	if source.DueAt != nil {
+		shifted := source.DueAt.Add(offset)
+		dueAt = &shifted
+	}
+
+	tasks := make([]*Task, 0, len(classroomIds))
+	for _, classId := range classroomIds {
+		task := &Task{
+			Header:      source.Header,
+			Description: source.Description,
+			DueAt:       dueAt,
+		}
+		if err := validateTask(task); err != nil {
+			return nil, err
+		}
+
+		if err := t.insert(ctx, tx, task, actor, classId); err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+	return tasks, nil
+}
+
+// lockClassrooms locks the classrooms until tx ends, so they can't be deleted or archived
+// before what tx adds to them is committed. It returns FieldErrors if one of them doesn't
+// exist, is deleted or is archived.
+func lockClassrooms(ctx context.Context, tx *sql.Tx, classroomIds []int) error {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT id FROM classroom
+		WHERE id = ANY($1) AND deleted_at IS NULL AND archived_at IS NULL
+		FOR SHARE
+`, pq.Array(classroomIds))
+	if err != nil {
+		return err
+	}
+	found, err := scanIds(rows)
+	if err != nil {
+		return err
+	}
+
+	for _, classId := range classroomIds {
+		if !slices.Contains(found, classId) {
+			return FieldErrors{"classrooms": fmt.Sprintf("classroom %d does not exist or is archived", classId)}
+		}
+	}
+	return nil
+}
+
+// InArchivedClassroom reports whether the task belongs to a classroom that is archived, which
+// makes the task read-only.
+func (t *TaskModel) InArchivedClassroom(id int) (bool, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var archived bool
+	err := t.DB.QueryRowContext(ctx, archivedTaskQuery, id).Scan(&archived)
+	return archived, err
+}
+
+const archivedTaskQuery = `
+		SELECT EXISTS (
+			SELECT 1 FROM classroom_task ct
+				INNER JOIN classroom c ON c.id = ct.class_id
+			WHERE ct.task_id = $1 AND c.archived_at IS NOT NULL
+		)
+`
+
+// checkNotArchived returns ErrArchived if the task belongs to an archived classroom.
+func checkNotArchived(ctx context.Context, tx *sql.Tx, taskId int) error {
+	var archived bool
+	if err := tx.QueryRowContext(ctx, archivedTaskQuery, taskId).Scan(&archived); err != nil {
+		return err
+	}
+	if archived {
+		return ErrArchived
+	}
+	return nil
+}
+
+// classroomIdsOf returns the ids of the classrooms the task is linked to in tx.
+func classroomIdsOf(ctx context.Context, tx *sql.Tx, taskId int) ([]int, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT class_id FROM classroom_task WHERE task_id = $1 ORDER BY class_id`, taskId)
+	if err != nil {
+		return nil, err
+	}
+	return scanIds(rows)
+}
+
+// scanIds reads and closes rows of a single int column.
+func scanIds(rows *sql.Rows) ([]int, error) {
+	defer rows.Close()
+
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return ids, rows.Close()
 }
 
 func ValidateTask(v *validator.Validator, task *Task) {
 	v.Check(task.Header != "", "header", "must be provided")
 	v.Check(len(task.Header) <= 50, "header", "must be no more than 50 bytes long")
 	v.Check(len(task.Description) <= 3000, "description", "must be no more than 1000 bytes long")
+	v.Check(task.DueAt == nil || task.DueAt.Year() >= 2000, "dueAt", "must be after the year 2000")
+	v.Check(task.DueAt == nil || task.DueAt.Year() < 10000, "dueAt", "must be before the year 10000")
 }
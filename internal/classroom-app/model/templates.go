@@ -0,0 +1,290 @@
+package model
+
+import (
+	"FinalProject/internal/classroom-app/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+)
+
+// Which templates a template list shows.
+const (
+	TemplatesAll    = "all"
+	TemplatesMine   = "mine"
+	TemplatesShared = "shared"
+)
+
+// TaskTemplate is a task that can be created again and again. It belongs to the user who made
+// it, and every user can see and use it once it is shared.
+type TaskTemplate struct {
+	Id          int        `json:"id"`
+	OwnerID     int        `json:"ownerId"`
+	Shared      bool       `json:"shared"`
+	Header      string     `json:"header"`
+	Description string     `json:"description"`
+	DueAt       *time.Time `json:"dueAt"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+	Version     int        `json:"version"`
+}
+
+type TemplateModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+
+	Tasks TaskModel
+}
+
+func (m TemplateModel) Insert(template *TaskTemplate, actor Actor) error {
+	query := `
+		INSERT INTO task_templates (owner_id, shared, header, description, due_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at, version
+		`
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	args := []any{template.OwnerID, template.Shared, template.Header, template.Description, template.DueAt}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&template.Id, &template.CreatedAt, &template.UpdatedAt, &template.Version)
+	if err != nil {
+		return err
+	}
+
+	err = insertAuditEntry(ctx, tx, actor, AuditCreate, EntityTemplate, template.Id, nil, template)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Get returns the template if the user owns it or it is shared, otherwise ErrRecordNotFound.
+func (m TemplateModel) Get(id int, userID int) (*TaskTemplate, error) {
+	query := `
+		SELECT id, owner_id, shared, header, description, due_at, created_at, updated_at, version
+		FROM task_templates
+		WHERE id = $1 AND (owner_id = $2 OR shared)
+		`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	template, err := scanTemplate(m.DB.QueryRowContext(ctx, query, id, userID))
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return template, nil
+}
+
+// GetAll returns the templates the user can see, ordered by header: all of them, only their
+// own or only the shared ones, depending on scope.
+func (m TemplateModel) GetAll(userID int, scope string, filters Filters) ([]*TaskTemplate, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), id, owner_id, shared, header, description, due_at, created_at, updated_at, version
+		FROM task_templates
+		WHERE CASE $2
+			WHEN 'mine' THEN owner_id = $1
+			WHEN 'shared' THEN shared
+			ELSE owner_id = $1 OR shared
+		END
+		ORDER BY header, id
+		LIMIT $3 OFFSET $4
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, scope, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	totalRecords := 0
+
+	templates := []*TaskTemplate{}
+	for rows.Next() {
+		var template TaskTemplate
+		err := rows.Scan(
+			&totalRecords,
+			&template.Id,
+			&template.OwnerID,
+			&template.Shared,
+			&template.Header,
+			&template.Description,
+			&template.DueAt,
+			&template.CreatedAt,
+			&template.UpdatedAt,
+			&template.Version,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		templates = append(templates, &template)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return templates, metadata, nil
+}
+
+// Update updates the template if its version hasn't changed since it was read, otherwise
+// ErrEditConflict is returned.
+func (m TemplateModel) Update(template *TaskTemplate, actor Actor) error {
+	query := `
+		UPDATE task_templates
+		SET shared = $1, header = $2, description = $3, due_at = $4, updated_at = now(), version = version + 1
+		WHERE id = $5
+		RETURNING updated_at, version
+		`
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := m.getForUpdate(ctx, tx, template.Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	if before.Version != template.Version {
+		return ErrEditConflict
+	}
+
+	args := []any{template.Shared, template.Header, template.Description, template.DueAt, template.Id}
+	err = tx.QueryRowContext(ctx, query, args...).Scan(&template.UpdatedAt, &template.Version)
+	if err != nil {
+		return err
+	}
+
+	err = insertAuditEntry(ctx, tx, actor, AuditUpdate, EntityTemplate, template.Id, before, template)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete deletes the template for good, templates don't go to the trash.
+func (m TemplateModel) Delete(id int, actor Actor) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := m.getForUpdate(ctx, tx, id)
+	if err != nil {
+		return notFound(err)
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM task_templates WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	err = insertAuditEntry(ctx, tx, actor, AuditDelete, EntityTemplate, id, before, nil)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Instantiate creates a task from the template in each of the classrooms, with the due date of
+// the template shifted by offset. It returns FieldErrors if one of the classrooms doesn't exist
+// or the shifted due date isn't valid.
+func (m TemplateModel) Instantiate(template *TaskTemplate, classroomIds []int, offset time.Duration, actor Actor) ([]*Task, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	source := &Task{
+		Header:      template.Header,
+		Description: template.Description,
+		DueAt:       template.DueAt,
+	}
+
+	tasks, err := m.Tasks.insertCopies(ctx, tx, source, classroomIds, offset, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return tasks, nil
+}
+
+// getForUpdate reads a template and locks it until tx ends.
+func (m TemplateModel) getForUpdate(ctx context.Context, tx *sql.Tx, id int) (*TaskTemplate, error) {
+	query := `
+		SELECT id, owner_id, shared, header, description, due_at, created_at, updated_at, version
+		FROM task_templates
+		WHERE id = $1
+		FOR UPDATE
+		`
+	return scanTemplate(tx.QueryRowContext(ctx, query, id))
+}
+
+func scanTemplate(row *sql.Row) (*TaskTemplate, error) {
+	var template TaskTemplate
+	err := row.Scan(
+		&template.Id,
+		&template.OwnerID,
+		&template.Shared,
+		&template.Header,
+		&template.Description,
+		&template.DueAt,
+		&template.CreatedAt,
+		&template.UpdatedAt,
+		&template.Version,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+// ValidateTaskTemplate checks a template like the tasks made from it are checked.
+func ValidateTaskTemplate(v *validator.Validator, template *TaskTemplate) {
+	ValidateTask(v, &Task{Header: template.Header, Description: template.Description, DueAt: template.DueAt})
+}
+
+func ValidateTemplateScope(v *validator.Validator, scope string) {
+	v.Check(validator.In(scope, TemplatesAll, TemplatesMine, TemplatesShared), "scope", "must be all, mine or shared")
+}
@@ -0,0 +1,229 @@
+package model
+
+import (
+	"FinalProject/internal/classroom-app/validator"
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"time"
+)
+
+// dateLayout is the layout of the start and end dates of terms.
+const dateLayout = "2006-01-02"
+
+// Term is an academic term, like a semester. Classrooms can be assigned to one.
+type Term struct {
+	Id        int       `json:"id"`
+	Name      string    `json:"name"`
+	StartsOn  string    `json:"startsOn"`
+	EndsOn    string    `json:"endsOn"`
+	CreatedAt time.Time `json:"createdAt"`
+	Version   int       `json:"version"`
+}
+
+type TermModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+}
+
+func (m TermModel) Insert(term *Term, actor Actor) error {
+	query := `
+		INSERT INTO terms (name, starts_on, ends_on)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, version
+		`
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRowContext(ctx, query, term.Name, term.StartsOn, term.EndsOn).Scan(&term.Id, &term.CreatedAt, &term.Version)
+	if err != nil {
+		return duplicateTerm(err)
+	}
+
+	err = insertAuditEntry(ctx, tx, actor, AuditCreate, EntityTerm, term.Id, nil, term)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m TermModel) Get(id int) (*Term, error) {
+	query := `
+		SELECT id, name, starts_on::text, ends_on::text, created_at, version FROM terms
+		WHERE id = $1
+		`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var term Term
+	err := m.DB.QueryRowContext(ctx, query, id).Scan(&term.Id, &term.Name, &term.StartsOn, &term.EndsOn, &term.CreatedAt, &term.Version)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return &term, nil
+}
+
+// GetAll returns the terms, the most recent first.
+func (m TermModel) GetAll(filters Filters) ([]*Term, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), id, name, starts_on::text, ends_on::text, created_at, version FROM terms
+		ORDER BY starts_on DESC, id DESC
+		LIMIT $1 OFFSET $2
+		`
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	totalRecords := 0
+
+	terms := []*Term{}
+	for rows.Next() {
+		var term Term
+		err := rows.Scan(&totalRecords, &term.Id, &term.Name, &term.StartsOn, &term.EndsOn, &term.CreatedAt, &term.Version)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		terms = append(terms, &term)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return terms, metadata, nil
+}
+
+// Update updates the term if its version hasn't changed since it was read, otherwise
+// ErrEditConflict is returned.
+func (m TermModel) Update(term *Term, actor Actor) error {
+	query := `
+		UPDATE terms
+		SET name = $1, starts_on = $2, ends_on = $3, version = version + 1
+		WHERE id = $4
+		RETURNING version
+		`
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := m.getForUpdate(ctx, tx, term.Id)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrEditConflict
+		default:
+			return err
+		}
+	}
+
+	if before.Version != term.Version {
+		return ErrEditConflict
+	}
+
+	err = tx.QueryRowContext(ctx, query, term.Name, term.StartsOn, term.EndsOn, term.Id).Scan(&term.Version)
+	if err != nil {
+		return duplicateTerm(err)
+	}
+
+	err = insertAuditEntry(ctx, tx, actor, AuditUpdate, EntityTerm, term.Id, before, term)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete deletes the term. Its classrooms are kept without a term.
+func (m TermModel) Delete(id int, actor Actor) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := m.getForUpdate(ctx, tx, id)
+	if err != nil {
+		return notFound(err)
+	}
+
+	_, err = tx.ExecContext(ctx, `DELETE FROM terms WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+
+	err = insertAuditEntry(ctx, tx, actor, AuditDelete, EntityTerm, id, before, nil)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// getForUpdate reads a term and locks it until tx ends.
+func (m TermModel) getForUpdate(ctx context.Context, tx *sql.Tx, id int) (*Term, error) {
+	query := `
+		SELECT id, name, starts_on::text, ends_on::text, created_at, version FROM terms
+		WHERE id = $1
+		FOR UPDATE
+		`
+
+	var term Term
+	err := tx.QueryRowContext(ctx, query, id).Scan(&term.Id, &term.Name, &term.StartsOn, &term.EndsOn, &term.CreatedAt, &term.Version)
+	if err != nil {
+		return nil, err
+	}
+	return &term, nil
+}
+
+// duplicateTerm turns the error of writing a term with the name of another one into
+// FieldErrors.
+func duplicateTerm(err error) error {
+	if strings.Contains(err.Error(), `"terms_name_key"`) {
+		return FieldErrors{"name": "a term with this name already exists"}
+	}
+	return err
+}
+
+func ValidateTerm(v *validator.Validator, term *Term) {
+	v.Check(term.Name != "", "name", "must be provided")
+	v.Check(len(term.Name) <= 100, "name", "must be no more than 100 bytes long")
+
+	startsOn, err := time.Parse(dateLayout, term.StartsOn)
+	v.Check(err == nil, "startsOn", "must be a date like 2006-01-02")
+	endsOn, err := time.Parse(dateLayout, term.EndsOn)
+	v.Check(err == nil, "endsOn", "must be a date like 2006-01-02")
+
+	if v.Valid() {
+		v.Check(!endsOn.Before(startsOn), "endsOn", "must not be before startsOn")
+	}
+}
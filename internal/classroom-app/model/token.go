@@ -15,6 +15,14 @@ import (
 const (
 	ScopeActivation     = "activation"
 	ScopeAuthentication = "authentication"
+	// ScopeCalendar tokens only give read access to the calendar feed of their user.
+	ScopeCalendar = "calendar"
+	// ScopeCheckIn tokens are the attendance check-in codes a teacher shows in class.
+	ScopeCheckIn = "check_in"
+	// ScopeInvitation tokens are the codes a roster import creates for new accounts, which the
+	// teacher passes on. They can only set the first password of an account that was never
+	// activated.
+	ScopeInvitation = "invitation"
 )
 
 type (
@@ -34,19 +42,38 @@ type (
 )
 
 // New creates a new token and inserts the token record into the tokens table.
-func (m TokenModel) New(userID int, ttl time.Duration, scope string) (*Token, error) {
+func (m TokenModel) New(userID int, ttl time.Duration, scope string, actor Actor) (*Token, error) {
 	token, err := generateToken(userID, ttl, scope)
 	if err != nil {
 		return nil, err
 	}
 
-	err = m.Insert(token)
+	err = m.Insert(token, actor)
 	return token, err
 
 }
 
-// Insert inserts a new token record into the tokens table.
-func (m TokenModel) Insert(token *Token) error {
+// Insert inserts a new token record into the tokens table. The audit log entry is keyed by
+// the user the token belongs to and never contains the token itself.
+func (m TokenModel) Insert(token *Token, actor Actor) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = insertToken(ctx, tx, token, actor); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insertToken inserts the token and its audit entry as part of tx.
+func insertToken(ctx context.Context, tx *sql.Tx, token *Token, actor Actor) error {
 	query := `
 		INSERT INTO tokens (hash, user_id, expiry, scope)
 		VALUES ($1, $2, $3, $4)
@@ -54,15 +81,17 @@ func (m TokenModel) Insert(token *Token) error {
 
 	args := []interface{}{token.Hash, token.UserID, token.Expiry, token.Scope}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
-	defer cancel()
+	_, err := tx.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
 
-	_, err := m.DB.ExecContext(ctx, query, args...)
-	return err
+	after := map[string]any{"scope": token.Scope, "expiry": token.Expiry}
+	return insertAuditEntry(ctx, tx, actor, AuditCreate, EntityToken, token.UserID, nil, after)
 }
 
 // DeleteAllForUser deletes all tokens for a specific user and scope.
-func (m TokenModel) DeleteAllForUser(scope string, userID int) error {
+func (m TokenModel) DeleteAllForUser(scope string, userID int, actor Actor) error {
 	query := `
 		DELETE FROM tokens
 		WHERE scope = $1 AND user_id = $2
@@ -71,8 +100,82 @@ func (m TokenModel) DeleteAllForUser(scope string, userID int) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
 	defer cancel()
 
-	_, err := m.DB.ExecContext(ctx, query, scope, userID)
-	return err
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, scope, userID)
+	if err != nil {
+		return err
+	}
+
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	before := map[string]any{"scope": scope, "count": deleted}
+	err = insertAuditEntry(ctx, tx, actor, AuditDelete, EntityToken, userID, before, nil)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DeleteExpired deletes expired tokens in batches of batchSize rows, so that no single
+// statement holds its locks for long. Every batch is recorded in the audit log as one entry
+// with the number of tokens it deleted. It returns the number of deleted tokens.
+func (m TokenModel) DeleteExpired(batchSize int) (int64, error) {
+	var deleted int64
+	for {
+		n, err := m.deleteExpiredBatch(batchSize)
+		deleted += n
+		if err != nil || n < int64(batchSize) {
+			return deleted, err
+		}
+	}
+}
+
+func (m TokenModel) deleteExpiredBatch(batchSize int) (int64, error) {
+	query := `
+		DELETE FROM tokens
+		WHERE hash IN (
+			SELECT hash FROM tokens
+			WHERE expiry < now()
+			LIMIT $1
+		)
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, query, batchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil || n == 0 {
+		return 0, err
+	}
+
+	// The entry is keyed by 0 as the batch spans many users.
+	before := map[string]any{"expired": n}
+	err = insertAuditEntry(ctx, tx, Actor{}, AuditPurge, EntityToken, 0, before, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	return n, tx.Commit()
 }
 
 func generateToken(userID int, ttl time.Duration, scope string) (*Token, error) {
@@ -0,0 +1,150 @@
+package model
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+)
+
+type TrashItem struct {
+	Type      string    `json:"type"`
+	Id        int       `json:"id"`
+	Title     string    `json:"title"`
+	DeletedAt time.Time `json:"deleted_at"`
+	PurgeAt   time.Time `json:"purge_at"`
+}
+
+type TrashModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+}
+
+// GetAllForUser returns the classrooms and tasks the user has deleted, most recent first.
+func (m TrashModel) GetAllForUser(userID int, filters Filters) ([]*TrashItem, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), type, id, title, deleted_at
+		FROM (
+			SELECT 'classroom' AS type, id, name AS title, deleted_at
+			FROM classroom
+			WHERE deleted_by = $1 AND deleted_at IS NOT NULL
+			UNION ALL
+			SELECT 'task' AS type, id, header AS title, deleted_at
+			FROM task
+			WHERE deleted_by = $1 AND deleted_at IS NOT NULL
+		) trash
+		ORDER BY deleted_at DESC, type ASC, id DESC
+		LIMIT $2 OFFSET $3
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, userID, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	totalRecords := 0
+
+	items := []*TrashItem{}
+	for rows.Next() {
+		var item TrashItem
+		err := rows.Scan(&totalRecords, &item.Type, &item.Id, &item.Title, &item.DeletedAt)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+
+		items = append(items, &item)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return items, metadata, nil
+}
+
+// Purge permanently deletes the classrooms and tasks that have been in the trash for longer
+// than retention. Every purged record is written to the audit log as a system change. It
+// returns the number of deleted rows.
+func (m TrashModel) Purge(retention time.Duration) (int64, error) {
+	purges := []struct {
+		entityType string
+		query      string
+	}{
+		{EntityClassroom, `
+			DELETE FROM classroom WHERE deleted_at < $1
+			RETURNING id, name, description, deleted_at, deleted_by
+			`},
+		{EntityTask, `
+			DELETE FROM task WHERE deleted_at < $1
+			RETURNING id, header, description, deleted_at, deleted_by
+			`},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := m.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	type purgedRecord struct {
+		Id          int       `json:"id"`
+		Title       string    `json:"title"`
+		Description string    `json:"description"`
+		DeletedAt   time.Time `json:"deleted_at"`
+		DeletedBy   *int      `json:"deleted_by"`
+	}
+
+	var purged int64
+	for _, purge := range purges {
+		rows, err := tx.QueryContext(ctx, purge.query, time.Now().Add(-retention))
+		if err != nil {
+			return 0, err
+		}
+
+		var records []purgedRecord
+		for rows.Next() {
+			var record purgedRecord
+			err := rows.Scan(&record.Id, &record.Title, &record.Description, &record.DeletedAt, &record.DeletedBy)
+			if err != nil {
+				rows.Close()
+				return 0, err
+			}
+			records = append(records, record)
+		}
+		if err = rows.Err(); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if err = rows.Close(); err != nil {
+			return 0, err
+		}
+
+		for _, record := range records {
+			err := insertAuditEntry(ctx, tx, Actor{}, AuditPurge, purge.entityType, record.Id, record, nil)
+			if err != nil {
+				return 0, err
+			}
+		}
+		purged += int64(len(records))
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return purged, nil
+}
@@ -2,13 +2,16 @@ package model
 
 import (
 	"FinalProject/internal/classroom-app/validator"
+	"bytes"
 	"context"
+	"crypto/rand"
 	"crypto/sha256"
 	"database/sql"
 	"errors"
 	"log"
 	"time"
 
+	"github.com/lib/pq"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -68,19 +71,53 @@ func (p *password) Matches(plaintextPassword string) (bool, error) {
 	return true, nil
 }
 
-func (u UserModel) Insert(user *User) error {
+// SetUnusable sets the password to a random one that nobody knows, for users who are created
+// on someone else's behalf and set their own password when they activate their account.
+func (p *password) SetUnusable() error {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword(random, 12)
+	if err != nil {
+		return err
+	}
+
+	p.plaintext = nil
+	p.hash = hash
+	return nil
+}
+
+func (u UserModel) Insert(user *User, actor Actor) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := u.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = insertUser(ctx, tx, user, actor); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// insertUser inserts the user and its audit entry as part of tx.
+func insertUser(ctx context.Context, tx *sql.Tx, user *User, actor Actor) error {
 	query := `
 			INSERT INTO users (first_name, last_name, email, password_hash, activated) 
 			VALUES ($1, $2, $3, $4, $5) 
 			RETURNING id, created_at
 `
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
 
 	args := []any{user.FirstName, user.LastName, user.Email, user.Password.hash, user.Activated}
 
 	pqErr := `pq: duplicate key value violates unique constraint "users_email_key"`
-	err := u.DB.QueryRowContext(ctx, query, args...).Scan(&user.Id, &user.CreatedAt)
+	err := tx.QueryRowContext(ctx, query, args...).Scan(&user.Id, &user.CreatedAt)
 	if err != nil {
 		switch {
 		case err.Error() == pqErr:
@@ -89,7 +126,8 @@ func (u UserModel) Insert(user *User) error {
 			return err
 		}
 	}
-	return nil
+
+	return insertAuditEntry(ctx, tx, actor, AuditCreate, EntityUser, user.Id, nil, user)
 }
 
 func (u UserModel) GetByEmail(email string) (*User, error) {
@@ -121,7 +159,7 @@ func (u UserModel) GetByEmail(email string) (*User, error) {
 	return &user, err
 }
 
-func (u UserModel) Update(user *User) error {
+func (u UserModel) Update(user *User, actor Actor) error {
 	query := `
 			UPDATE users 
 			SET first_name=$1, last_name=$2, email=$3, password_hash=$4, activated=$5
@@ -130,8 +168,37 @@ func (u UserModel) Update(user *User) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	tx, err := u.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var before User
+	err = tx.QueryRowContext(ctx, `
+			SELECT id, created_at, first_name, last_name, email, password_hash, activated FROM users
+			WHERE id=$1
+			FOR UPDATE
+`, user.Id).Scan(
+		&before.Id,
+		&before.CreatedAt,
+		&before.FirstName,
+		&before.LastName,
+		&before.Email,
+		&before.Password.hash,
+		&before.Activated,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return ErrRecordNotFound
+		default:
+			return err
+		}
+	}
+
 	args := []any{user.FirstName, user.LastName, user.Email, user.Password.hash, user.Activated, user.Id}
-	_, err := u.DB.ExecContext(ctx, query, args...)
+	_, err = tx.ExecContext(ctx, query, args...)
 	if err != nil {
 		switch {
 		case err.Error() == `pq: duplicate key value violates unique constraint "users_email_key"`:
@@ -140,7 +207,234 @@ func (u UserModel) Update(user *User) error {
 			return err
 		}
 	}
-	return nil
+
+	// The password hash is never written to the audit log, only the fact that it changed.
+	after := struct {
+		*User
+		Password string `json:"password,omitempty"`
+	}{User: user}
+	if !bytes.Equal(before.Password.hash, user.Password.hash) {
+		after.Password = "changed"
+	}
+
+	err = insertAuditEntry(ctx, tx, actor, AuditUpdate, EntityUser, user.Id, &before, after)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AcceptInvitation sets the first password of a user created by a roster import and activates
+// their account, using up the invitation code they were given. It returns ErrRecordNotFound if
+// the code is invalid or expired, or if the account was activated already: its password may
+// then be one its owner chose, and a code that passed through a teacher's hands must not
+// replace it.
+func (u UserModel) AcceptInvitation(tokenPlaintext, passwordPlaintext string, actor Actor) (*User, error) {
+	var newPassword password
+	if err := newPassword.Set(passwordPlaintext); err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := u.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Deleting the codes first uses them up, so that two requests with the same code can't
+	// both set a password.
+	tokenHash := sha256.Sum256([]byte(tokenPlaintext))
+	rows, err := tx.QueryContext(ctx, `
+		DELETE FROM tokens
+		WHERE scope = $2 AND user_id = (
+			SELECT user_id FROM tokens WHERE hash = $1 AND scope = $2 AND expiry > now()
+		)
+		RETURNING user_id
+		`, tokenHash[:], ScopeInvitation)
+	if err != nil {
+		return nil, err
+	}
+	ids, err := scanIds(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, ErrRecordNotFound
+	}
+
+	// The user accepts the invitation themselves, so they are the actor from here on.
+	actor.UserID = ids[0]
+
+	before := map[string]any{"scope": ScopeInvitation, "count": len(ids)}
+	err = insertAuditEntry(ctx, tx, actor, AuditDelete, EntityToken, actor.UserID, before, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var user User
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, created_at, first_name, last_name, email, password_hash, activated FROM users
+		WHERE id = $1
+		FOR UPDATE
+		`, actor.UserID).Scan(
+		&user.Id,
+		&user.CreatedAt,
+		&user.FirstName,
+		&user.LastName,
+		&user.Email,
+		&user.Password.hash,
+		&user.Activated,
+	)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	if user.Activated {
+		return nil, ErrRecordNotFound
+	}
+
+	old := user
+	user.Password = newPassword
+	user.Activated = true
+
+	_, err = tx.ExecContext(ctx, `UPDATE users SET password_hash = $1, activated = true WHERE id = $2`, user.Password.hash, user.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	// The password hash is never written to the audit log, only the fact that it changed.
+	after := struct {
+		*User
+		Password string `json:"password"`
+	}{User: &user, Password: "changed"}
+	err = insertAuditEntry(ctx, tx, actor, AuditUpdate, EntityUser, user.Id, &old, after)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// DeleteUnactivated deletes the users who registered more than olderThan ago and never
+// activated their account, together with their tokens and permissions. Users who are members
+// of a classroom or still have a valid activation token or invitation code are kept, so that
+// their enrollments aren't lost. It deletes in batches of batchSize
+// users, each in a transaction of its own together with an audit entry for every deleted user
+// and one for the tokens and permissions of the batch. It returns the number of deleted users.
+func (u UserModel) DeleteUnactivated(olderThan time.Duration, batchSize int) (int64, error) {
+	query := `
+		SELECT id FROM users
+		WHERE NOT activated AND created_at < $1
+			AND NOT EXISTS (SELECT 1 FROM classroom_members cm WHERE cm.user_id = users.id)
+			AND NOT EXISTS (
+				SELECT 1 FROM tokens t
+				WHERE t.user_id = users.id AND t.scope IN ('activation', 'invitation')
+					AND t.expiry > now()
+			)
+		LIMIT $2
+		FOR UPDATE SKIP LOCKED
+		`
+
+	cutoff := time.Now().Add(-olderThan)
+
+	var deleted int64
+	for {
+		n, err := u.deleteBatch(query, cutoff, batchSize)
+		deleted += n
+		if err != nil || n < int64(batchSize) {
+			return deleted, err
+		}
+	}
+}
+
+func (u UserModel) deleteBatch(query string, cutoff time.Time, batchSize int) (int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := u.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, query, cutoff, batchSize)
+	if err != nil {
+		return 0, err
+	}
+	ids, err := scanIds(rows)
+	if err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	// The tokens and permissions would go with the users anyway, deleting them first only
+	// makes it possible to count them for the audit log.
+	var tokens, permissions int64
+	for _, cascade := range []struct {
+		query string
+		count *int64
+	}{
+		{`DELETE FROM tokens WHERE user_id = ANY($1)`, &tokens},
+		{`DELETE FROM users_permissions WHERE user_id = ANY($1)`, &permissions},
+	} {
+		result, err := tx.ExecContext(ctx, cascade.query, pq.Array(ids))
+		if err != nil {
+			return 0, err
+		}
+		if *cascade.count, err = result.RowsAffected(); err != nil {
+			return 0, err
+		}
+	}
+
+	rows, err = tx.QueryContext(ctx, `
+		DELETE FROM users
+		WHERE id = ANY($1)
+		RETURNING id, created_at, first_name, last_name, email, activated
+		`, pq.Array(ids))
+	if err != nil {
+		return 0, err
+	}
+
+	var users []User
+	for rows.Next() {
+		var user User
+		err := rows.Scan(&user.Id, &user.CreatedAt, &user.FirstName, &user.LastName, &user.Email, &user.Activated)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		users = append(users, user)
+	}
+	if err = rows.Err(); err != nil {
+		rows.Close()
+		return 0, err
+	}
+	if err = rows.Close(); err != nil {
+		return 0, err
+	}
+
+	for _, user := range users {
+		err := insertAuditEntry(ctx, tx, Actor{}, AuditPurge, EntityUser, user.Id, &user, nil)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	// One entry for the batch, keyed by 0 as it isn't about a single user.
+	summary := map[string]any{"users": len(users), "tokens": tokens, "permissions": permissions}
+	if err := insertAuditEntry(ctx, tx, Actor{}, AuditPurge, EntityUser, 0, summary, nil); err != nil {
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	return int64(len(users)), nil
 }
 
 func (m UserModel) GetForToken(tokenScope, tokenPlaintext string) (*User, error) {
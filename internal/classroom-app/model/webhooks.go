@@ -0,0 +1,397 @@
+package model
+
+import (
+	"FinalProject/internal/classroom-app/validator"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Events that webhooks can subscribe to.
+const (
+	EventClassroomCreated = "classroom.created"
+	EventTaskCreated      = "task.created"
+	EventTaskUpdated      = "task.updated"
+	EventUserActivated    = "user.activated"
+	EventQuizSubmitted    = "quiz.submitted"
+)
+
+var WebhookEvents = []string{
+	EventClassroomCreated,
+	EventTaskCreated,
+	EventTaskUpdated,
+	EventUserActivated,
+	EventQuizSubmitted,
+}
+
+// Statuses of a webhook delivery.
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// MaxDeliveryAttempts is the number of times a delivery is tried before it is marked failed.
+const MaxDeliveryAttempts = 8
+
+type Webhook struct {
+	Id        int       `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	Events    []string  `json:"events"`
+	Active    bool      `json:"active"`
+}
+
+type WebhookDelivery struct {
+	Id             int64           `json:"id"`
+	WebhookId      int             `json:"webhook_id"`
+	CreatedAt      time.Time       `json:"created_at"`
+	Event          string          `json:"event"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastStatusCode *int            `json:"last_status_code"`
+	LastError      string          `json:"last_error"`
+	DeliveredAt    *time.Time      `json:"delivered_at"`
+
+	// URL and Secret of the webhook, only filled in by ClaimDue for sending.
+	URL    string `json:"-"`
+	Secret string `json:"-"`
+}
+
+type WebhookModel struct {
+	DB       *sql.DB
+	InfoLog  *log.Logger
+	ErrorLog *log.Logger
+}
+
+func (m WebhookModel) Insert(webhook *Webhook, createdBy int) error {
+	query := `
+		INSERT INTO webhooks (created_by, url, secret, events)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, active
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{createdBy, webhook.URL, webhook.Secret, pq.Array(webhook.Events)}
+	return m.DB.QueryRowContext(ctx, query, args...).Scan(&webhook.Id, &webhook.CreatedAt, &webhook.Active)
+}
+
+// GetAll returns all registered webhooks without their secrets.
+func (m WebhookModel) GetAll() ([]*Webhook, error) {
+	query := `
+		SELECT id, created_at, url, events, active
+		FROM webhooks
+		ORDER BY id
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	webhooks := []*Webhook{}
+	for rows.Next() {
+		var webhook Webhook
+		err := rows.Scan(&webhook.Id, &webhook.CreatedAt, &webhook.URL, pq.Array(&webhook.Events), &webhook.Active)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, &webhook)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+func (m WebhookModel) Delete(id int) error {
+	query := `
+		DELETE FROM webhooks
+		WHERE id = $1
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	result, err := m.DB.ExecContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return ErrRecordNotFound
+	}
+	return nil
+}
+
+// Enqueue creates a pending delivery of the event for every active webhook subscribed to it.
+func (m WebhookModel) Enqueue(event string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, event, payload)
+		SELECT id, $1, $2 FROM webhooks
+		WHERE active AND $1 = ANY(events)
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	_, err = m.DB.ExecContext(ctx, query, event, string(payload))
+	return err
+}
+
+// ClaimDue returns up to limit pending deliveries that are due, together with the URL and
+// secret of their webhook. Claimed deliveries are leased for the given duration by moving
+// their next attempt forward, so that other workers skip them while they are being sent.
+func (m WebhookModel) ClaimDue(limit int, lease time.Duration) ([]*WebhookDelivery, error) {
+	query := `
+		UPDATE webhook_deliveries d
+		SET next_attempt_at = now() + make_interval(secs => $2)
+		FROM webhooks w
+		WHERE w.id = d.webhook_id
+			AND d.id IN (
+				SELECT id FROM webhook_deliveries
+				WHERE status = 'pending' AND next_attempt_at <= now()
+				ORDER BY next_attempt_at
+				LIMIT $1
+				FOR UPDATE SKIP LOCKED
+			)
+		RETURNING d.id, d.webhook_id, d.created_at, d.event, d.payload, d.attempts, w.url, w.secret
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	var deliveries []*WebhookDelivery
+	for rows.Next() {
+		var delivery WebhookDelivery
+		err := rows.Scan(
+			&delivery.Id,
+			&delivery.WebhookId,
+			&delivery.CreatedAt,
+			&delivery.Event,
+			&delivery.Payload,
+			&delivery.Attempts,
+			&delivery.URL,
+			&delivery.Secret,
+		)
+		if err != nil {
+			return nil, err
+		}
+		delivery.Status = DeliveryPending
+		deliveries = append(deliveries, &delivery)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// RecordAttempt stores the outcome of a delivery attempt. A failed attempt is retried with
+// exponential backoff until MaxDeliveryAttempts is reached, after which the delivery is
+// marked failed.
+func (m WebhookModel) RecordAttempt(delivery *WebhookDelivery, statusCode int, attemptErr error) error {
+	delivery.Attempts++
+
+	var code *int
+	if statusCode != 0 {
+		code = &statusCode
+	}
+	delivery.LastStatusCode = code
+
+	switch {
+	case attemptErr == nil:
+		now := time.Now()
+		delivery.Status = DeliverySucceeded
+		delivery.LastError = ""
+		delivery.DeliveredAt = &now
+	case delivery.Attempts >= MaxDeliveryAttempts:
+		delivery.Status = DeliveryFailed
+		delivery.LastError = attemptErr.Error()
+	default:
+		delivery.Status = DeliveryPending
+		delivery.LastError = attemptErr.Error()
+		delivery.NextAttemptAt = time.Now().Add(retryBackoff(delivery.Attempts))
+	}
+
+	query := `
+		UPDATE webhook_deliveries
+		SET status = $2, attempts = $3, last_status_code = $4, last_error = $5,
+			next_attempt_at = COALESCE($6, next_attempt_at), delivered_at = $7
+		WHERE id = $1
+		`
+
+	var next *time.Time
+	if delivery.Status == DeliveryPending {
+		next = &delivery.NextAttemptAt
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	args := []any{delivery.Id, delivery.Status, delivery.Attempts, code, delivery.LastError, next, delivery.DeliveredAt}
+	_, err := m.DB.ExecContext(ctx, query, args...)
+	return err
+}
+
+// retryBackoff returns how long to wait before the next attempt: 30 seconds after the first
+// failure, doubling with every attempt up to 6 hours.
+func retryBackoff(attempts int) time.Duration {
+	backoff := 30 * time.Second
+	for i := 1; i < attempts && backoff < 6*time.Hour; i++ {
+		backoff *= 2
+	}
+	return min(backoff, 6*time.Hour)
+}
+
+// GetDeliveries returns the delivery log of a webhook, newest first.
+func (m WebhookModel) GetDeliveries(webhookId int, filters Filters) ([]*WebhookDelivery, Metadata, error) {
+	query := `
+		SELECT count(*) OVER(), id, webhook_id, created_at, event, payload, status, attempts,
+			next_attempt_at, last_status_code, last_error, delivered_at
+		FROM webhook_deliveries
+		WHERE webhook_id = $1
+		ORDER BY id DESC
+		LIMIT $2 OFFSET $3
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	rows, err := m.DB.QueryContext(ctx, query, webhookId, filters.limit(), filters.offset())
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	defer func() {
+		if err := rows.Close(); err != nil {
+			m.ErrorLog.Println(err)
+		}
+	}()
+
+	totalRecords := 0
+
+	deliveries := []*WebhookDelivery{}
+	for rows.Next() {
+		var delivery WebhookDelivery
+		err := rows.Scan(
+			&totalRecords,
+			&delivery.Id,
+			&delivery.WebhookId,
+			&delivery.CreatedAt,
+			&delivery.Event,
+			&delivery.Payload,
+			&delivery.Status,
+			&delivery.Attempts,
+			&delivery.NextAttemptAt,
+			&delivery.LastStatusCode,
+			&delivery.LastError,
+			&delivery.DeliveredAt,
+		)
+		if err != nil {
+			return nil, Metadata{}, err
+		}
+		deliveries = append(deliveries, &delivery)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	metadata := calculateMetadata(totalRecords, filters.Page, filters.PageSize)
+
+	return deliveries, metadata, nil
+}
+
+// Redeliver queues a new delivery with the same event and payload as an earlier one. The
+// original delivery is kept in the log as it was.
+func (m WebhookModel) Redeliver(deliveryId int64) (*WebhookDelivery, error) {
+	query := `
+		INSERT INTO webhook_deliveries (webhook_id, event, payload)
+		SELECT webhook_id, event, payload FROM webhook_deliveries
+		WHERE id = $1
+		RETURNING id, webhook_id, created_at, event, payload, status, attempts, next_attempt_at
+		`
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var delivery WebhookDelivery
+	err := m.DB.QueryRowContext(ctx, query, deliveryId).Scan(
+		&delivery.Id,
+		&delivery.WebhookId,
+		&delivery.CreatedAt,
+		&delivery.Event,
+		&delivery.Payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.NextAttemptAt,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrRecordNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return &delivery, nil
+}
+
+func ValidateWebhook(v *validator.Validator, webhook *Webhook) {
+	u, err := url.Parse(webhook.URL)
+	v.Check(webhook.URL != "", "url", "must be provided")
+	v.Check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "url", "must be an absolute http or https URL")
+	v.Check(len(webhook.URL) <= 2000, "url", "must be no more than 2000 bytes long")
+
+	v.Check(len(webhook.Events) > 0, "events", "must contain at least one event")
+	v.Check(validator.Unique(webhook.Events), "events", "must not contain duplicate values")
+	for _, event := range webhook.Events {
+		v.Check(validator.In(event, WebhookEvents...), "events", "unknown event "+event)
+	}
+}